@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces
+var _ provider.DataSourceType = callerIdentityDataSourceType{}
+var _ datasource.DataSource = callerIdentityDataSource{}
+
+type callerWorkspace struct {
+	Id      types.Int64  `tfsdk:"id"`
+	Name    types.String `tfsdk:"name"`
+	Plan    types.String `tfsdk:"plan"`
+	OwnerId types.Int64  `tfsdk:"owner_id"`
+	Active  types.Bool   `tfsdk:"active"`
+}
+
+type callerIdentity struct {
+	Id          types.String      `tfsdk:"id"`
+	AccessKey   types.String      `tfsdk:"access_key"`
+	WorkspaceId types.Int64       `tfsdk:"workspace_id"`
+	Workspaces  []callerWorkspace `tfsdk:"workspaces"`
+}
+
+type callerIdentityDataSourceType struct{}
+
+func (t callerIdentityDataSourceType) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Diagnostics) {
+	return tfsdk.Schema{
+		// This description is used by the documentation generator and the language server.
+		MarkdownDescription: "The access key the provider is authenticated with and the workspaces it can access. The OnFinality API has no endpoint for the user behind an access key, so the identity is the access key itself, a hash of it as `id`",
+
+		Attributes: map[string]tfsdk.Attribute{
+			"id": {
+				MarkdownDescription: "SHA-256 hash of access_key, identifying it without revealing it. The API doesn't expose the user the key belongs to",
+				Computed:            true,
+				Type:                types.StringType,
+			},
+			"access_key": {
+				MarkdownDescription: "Access key the provider signs requests with",
+				Computed:            true,
+				Sensitive:           true,
+				Type:                types.StringType,
+			},
+			"workspace_id": {
+				MarkdownDescription: "The provider's default workspace id, null if it doesn't set one",
+				Computed:            true,
+				Type:                types.Int64Type,
+			},
+			"workspaces": {
+				MarkdownDescription: "Workspaces the access key can access",
+				Computed:            true,
+				Attributes: tfsdk.ListNestedAttributes(map[string]tfsdk.Attribute{
+					"id":       {Type: types.Int64Type, Computed: true, MarkdownDescription: "Workspace id"},
+					"name":     {Type: types.StringType, Computed: true, MarkdownDescription: "Workspace name"},
+					"plan":     {Type: types.StringType, Computed: true, MarkdownDescription: "Billing plan of the workspace"},
+					"owner_id": {Type: types.Int64Type, Computed: true, MarkdownDescription: "User id of the workspace owner"},
+					"active":   {Type: types.BoolType, Computed: true, MarkdownDescription: "Whether the workspace is active"},
+				}),
+			},
+		},
+	}, nil
+}
+
+func (t callerIdentityDataSourceType) NewDataSource(ctx context.Context, in provider.Provider) (datasource.DataSource, diag.Diagnostics) {
+	provider, diags := convertProviderType(in)
+
+	return callerIdentityDataSource{
+		provider: provider,
+	}, diags
+}
+
+type callerIdentityDataSource struct {
+	provider onfinalityProvider
+}
+
+func (d callerIdentityDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	workspaces, err := d.provider.client.GetWorkspaceList(ctx)
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to list workspaces, got error: %s", err))
+		return
+	}
+
+	data := callerIdentity{
+		Id:          types.String{Value: fmt.Sprintf("%x", sha256.Sum256([]byte(d.provider.accessKey)))},
+		AccessKey:   types.String{Value: d.provider.accessKey},
+		WorkspaceId: types.Int64{Null: true},
+		Workspaces:  []callerWorkspace{},
+	}
+	if d.provider.workspaceId != 0 {
+		data.WorkspaceId = types.Int64{Value: d.provider.workspaceId}
+	}
+	for _, ws := range workspaces {
+		data.Workspaces = append(data.Workspaces, callerWorkspace{
+			Id:      types.Int64{Value: int64(ws.ID)},
+			Name:    types.String{Value: ws.Name},
+			Plan:    types.String{Value: ws.Plan},
+			OwnerId: types.Int64{Value: int64(ws.OwnerID)},
+			Active:  types.Bool{Value: ws.Active},
+		})
+	}
+
+	diags := resp.State.Set(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+}
@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestCallerIdentityDataSourceRead(t *testing.T) {
+	ctx := context.Background()
+	p := configureTestProvider(t, newFakeApi(t), "team-a-access")
+
+	d, diags := callerIdentityDataSourceType{}.NewDataSource(ctx, p)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	schema, _ := callerIdentityDataSourceType{}.GetSchema(ctx)
+	resp := datasource.ReadResponse{State: tfsdk.State{Schema: schema, Raw: tftypes.NewValue(schema.TerraformType(ctx), nil)}}
+	d.Read(ctx, datasource.ReadRequest{Config: tfsdk.Config{Schema: schema, Raw: resp.State.Raw}}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+
+	var data callerIdentity
+	resp.State.Get(ctx, &data)
+	if data.AccessKey.Value != "team-a-access" || data.WorkspaceId.Value != 10 || strings.Contains(data.Id.Value, "team-a-access") || len(data.Id.Value) != 64 {
+		t.Errorf("unexpected identity %+v", data)
+	}
+	if len(data.Workspaces) != 2 || data.Workspaces[0].Name.Value != "team a" || data.Workspaces[1].Id.Value != 20 {
+		t.Errorf("unexpected workspaces %+v", data.Workspaces)
+	}
+}
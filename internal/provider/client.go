@@ -0,0 +1,258 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/OnFinality-io/onf-cli/pkg/api"
+	onf "github.com/OnFinality-io/onf-cli/pkg/service"
+)
+
+// onfClient is the part of the OnFinality API used by the provider. Every
+// provider instance builds its own client in Configure and hands it to the
+// resources and data sources it creates, tests can substitute a fake.
+type onfClient interface {
+	CreateNode(ctx context.Context, wsId uint64, payload *onf.CreateNodePayload) (*nodeDetail, error)
+	GetNodeList(ctx context.Context, wsId uint64) ([]onf.NodeItem, error)
+	GetNodeDetail(ctx context.Context, wsId uint64, nodeId uint64) (*nodeDetail, error)
+	GetNodeStatus(ctx context.Context, wsId uint64, nodeId uint64) (*nodeStatus, error)
+	UpdateNode(ctx context.Context, wsId uint64, nodeId uint64, payload *onf.UpdateNodePayload) error
+	ExpandNodeStorage(ctx context.Context, wsId uint64, nodeId uint64, size string) error
+	StopNode(ctx context.Context, wsId uint64, nodeId uint64) error
+	ResumeNode(ctx context.Context, wsId uint64, nodeId uint64) error
+	TerminateNode(ctx context.Context, wsId uint64, nodeId uint64) error
+	GetWorkspaceList(ctx context.Context) ([]onf.Workspace, error)
+	GetInfo(ctx context.Context) (*onf.Info, error)
+}
+
+var _ onfClient = &apiClient{}
+
+// apiClient talks to the OnFinality API over HTTP, signing every request the
+// same way the onf CLI does. Unlike the onf service package it keeps its
+// credentials and endpoint on the instance instead of in package state.
+type apiClient struct {
+	baseUrl    string
+	signer     *api.Api
+	httpClient *http.Client
+	version    string
+	userAgent  string
+}
+
+func newApiClient(accessKey string, secretKey string, baseUrl string, version string, userAgent string, httpClient *http.Client) *apiClient {
+	return &apiClient{
+		baseUrl:    baseUrl,
+		signer:     api.New(accessKey, secretKey, baseUrl),
+		httpClient: httpClient,
+		version:    version,
+		userAgent:  userAgent,
+	}
+}
+
+// clusterCache fetches the clusters once, they rarely change and GET /info
+// returns the whole catalogue of the API.
+type clusterCache struct {
+	once     sync.Once
+	clusters []onf.Clusters
+	err      error
+}
+
+func (c *clusterCache) get(ctx context.Context, client onfClient) ([]onf.Clusters, error) {
+	c.once.Do(func() {
+		info, err := client.GetInfo(ctx)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.clusters = info.Clusters
+	})
+	return c.clusters, c.err
+}
+
+// nodeDetail is the response of the node endpoints. It adds the fields the
+// onf CLI doesn't decode to onf.Node, nil when the API doesn't report them.
+type nodeDetail struct {
+	onf.Node
+	InitFromBackup *bool  `json:"initFromBackup,omitempty"`
+	UseApiKey      *bool  `json:"useApiKey,omitempty"`
+	PublicPort     *bool  `json:"publicPort,omitempty"`
+	CreatedAt      string `json:"createdAt,omitempty"`
+	UpdatedAt      string `json:"updatedAt,omitempty"`
+}
+
+// nodeStatus is the response of the node status endpoint. Besides the status
+// the API may explain a failed node in message or reason.
+type nodeStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// failureReason returns the API's explanation of the status, if any.
+func (s *nodeStatus) failureReason() string {
+	if s.Message != "" {
+		return s.Message
+	}
+	return s.Reason
+}
+
+// apiError is returned when the API answers with a non-2xx status.
+type apiError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// isNotFound reports whether err is the API saying the resource doesn't exist.
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+func (c *apiClient) CreateNode(ctx context.Context, wsId uint64, payload *onf.CreateNodePayload) (*nodeDetail, error) {
+	node := &nodeDetail{}
+	err := c.do(ctx, http.MethodPost, false, 2, fmt.Sprintf("/workspaces/%d/nodes", wsId), payload, node)
+	return node, err
+}
+
+func (c *apiClient) GetNodeList(ctx context.Context, wsId uint64) ([]onf.NodeItem, error) {
+	var list []onf.NodeItem
+	err := c.do(ctx, http.MethodGet, true, 1, fmt.Sprintf("/workspaces/%d/nodes", wsId), nil, &list)
+	return list, err
+}
+
+func (c *apiClient) GetNodeDetail(ctx context.Context, wsId uint64, nodeId uint64) (*nodeDetail, error) {
+	node := &nodeDetail{}
+	err := c.do(ctx, http.MethodGet, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d", wsId, nodeId), nil, node)
+	return node, err
+}
+
+func (c *apiClient) GetNodeStatus(ctx context.Context, wsId uint64, nodeId uint64) (*nodeStatus, error) {
+	status := &nodeStatus{}
+	err := c.do(ctx, http.MethodGet, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d/status", wsId, nodeId), nil, status)
+	return status, err
+}
+
+func (c *apiClient) UpdateNode(ctx context.Context, wsId uint64, nodeId uint64, payload *onf.UpdateNodePayload) error {
+	return c.do(ctx, http.MethodPost, true, 2, fmt.Sprintf("/workspaces/%d/nodes/%d/update", wsId, nodeId), payload, nil)
+}
+
+func (c *apiClient) ExpandNodeStorage(ctx context.Context, wsId uint64, nodeId uint64, size string) error {
+	body := map[string]string{"storage": size}
+	return c.do(ctx, http.MethodPost, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d/expand-storage", wsId, nodeId), body, nil)
+}
+
+func (c *apiClient) StopNode(ctx context.Context, wsId uint64, nodeId uint64) error {
+	return c.do(ctx, http.MethodPost, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d/stop", wsId, nodeId), nil, nil)
+}
+
+func (c *apiClient) ResumeNode(ctx context.Context, wsId uint64, nodeId uint64) error {
+	return c.do(ctx, http.MethodPost, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d/resume", wsId, nodeId), nil, nil)
+}
+
+func (c *apiClient) TerminateNode(ctx context.Context, wsId uint64, nodeId uint64) error {
+	return c.do(ctx, http.MethodDelete, true, 1, fmt.Sprintf("/workspaces/%d/nodes/%d", wsId, nodeId), nil, nil)
+}
+
+func (c *apiClient) GetWorkspaceList(ctx context.Context) ([]onf.Workspace, error) {
+	var list []onf.Workspace
+	err := c.do(ctx, http.MethodGet, true, 1, "/workspaces", nil, &list)
+	return list, err
+}
+
+// GetInfo returns the clusters, node specs and protocols of the platform.
+func (c *apiClient) GetInfo(ctx context.Context) (*onf.Info, error) {
+	info := &onf.Info{}
+	err := c.do(ctx, http.MethodGet, true, 1, "/info", nil, info)
+	return info, err
+}
+
+// do sends a signed request to /v<version><path> and decodes the JSON
+// response into out when it is not nil. Requests which aren't idempotent are
+// only retried when the API didn't process them.
+func (c *apiClient) do(ctx context.Context, method string, idempotent bool, version int, path string, body interface{}, out interface{}) error {
+	u, err := url.Parse(fmt.Sprintf("%s/v%d%s", c.baseUrl, version, path))
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if body != nil {
+		data, err = encodeBody(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(withIdempotent(ctx, idempotent), method, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("user-agent", c.userAgent)
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("x-onf-client", "terraform-provider-onfinality")
+	req.Header.Set("x-onf-version", c.version)
+	if body != nil {
+		req.Header.Set("content-md5", fmt.Sprintf("%x", md5.Sum(data)))
+	}
+	req.Header.Set("date", time.Now().UTC().Format(http.TimeFormat))
+	signature := c.signer.GetSign(method, u.RequestURI(), req.Header)
+	req.Header.Set("authorization", fmt.Sprintf("ONF %s:%s", c.signer.AccessKey, signature))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		return newApiError(resp, respData)
+	}
+	if out == nil || len(respData) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respData, out)
+}
+
+// encodeBody serialises body the way the onf CLI does: as a JSON object with
+// sorted keys, which is what the content-md5 header is computed over.
+func encodeBody(body interface{}) ([]byte, error) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+func newApiError(resp *http.Response, data []byte) *apiError {
+	e := &apiError{StatusCode: resp.StatusCode, Status: resp.Status}
+	var r struct {
+		Message interface{} `json:"message"`
+	}
+	if err := json.Unmarshal(data, &r); err == nil && r.Message != nil {
+		e.Message = fmt.Sprint(r.Message)
+	} else {
+		e.Message = string(bytes.TrimSpace(data))
+	}
+	return e
+}
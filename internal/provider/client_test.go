@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OnFinality-io/onf-cli/pkg/api"
+	onf "github.com/OnFinality-io/onf-cli/pkg/service"
+)
+
+func TestApiClientSignsRequests(t *testing.T) {
+	signer := api.New("test-access", "test-secret", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if len(body) > 0 && r.Header.Get("content-md5") != fmt.Sprintf("%x", md5.Sum(body)) {
+			t.Errorf("content-md5 doesn't match the body %s", body)
+		}
+		if r.Header.Get("user-agent") != "terraform-provider-onfinality/test" {
+			t.Errorf("unexpected user agent %q", r.Header.Get("user-agent"))
+		}
+		expected := fmt.Sprintf("ONF test-access:%s", signer.GetSign(r.Method, r.URL.RequestURI(), r.Header))
+		if r.Header.Get("authorization") != expected {
+			t.Errorf("unexpected authorization %q, expected %q", r.Header.Get("authorization"), expected)
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/workspaces/1/nodes/2":
+			fmt.Fprint(w, `{"id": "2", "workspaceId": "1", "name": "n1", "status": "running"}`)
+		case "/api/v1/workspaces/1/nodes/2/expand-storage":
+			if string(body) != `{"storage":"200Gi"}` {
+				t.Errorf("unexpected body %s", body)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "node not found"}`)
+		}
+	}))
+	defer server.Close()
+
+	client := newApiClient("test-access", "test-secret", server.URL+"/api", "test", "terraform-provider-onfinality/test", &http.Client{})
+	ctx := context.Background()
+
+	node, err := client.GetNodeDetail(ctx, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.ID != 2 || node.WorkspaceID != 1 || node.Name != "n1" || node.Status != "running" {
+		t.Errorf("unexpected node %+v", node)
+	}
+
+	if err := client.ExpandNodeStorage(ctx, 1, 2, "200Gi"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.StopNode(ctx, 1, 3)
+	apiErr, ok := err.(*apiError)
+	if !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "node not found" {
+		t.Errorf("unexpected error %#v", err)
+	}
+}
+
+func TestApiClientRetriesIdempotentCalls(t *testing.T) {
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts[r.URL.Path]++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	transport := newRetryTransport(http.DefaultTransport, 2)
+	transport.minBackoff = time.Millisecond
+	transport.maxBackoff = 5 * time.Millisecond
+	client := newApiClient("test-access", "test-secret", server.URL+"/api", "test", "terraform-provider-onfinality/test", &http.Client{Transport: transport})
+	ctx := context.Background()
+
+	// creating twice could leave a duplicate node
+	_, _ = client.CreateNode(ctx, 1, &onf.CreateNodePayload{})
+	if n := attempts["/api/v2/workspaces/1/nodes"]; n != 1 {
+		t.Errorf("expected CreateNode not to be retried, got %d attempts", n)
+	}
+	_ = client.UpdateNode(ctx, 1, 2, &onf.UpdateNodePayload{})
+	if n := attempts["/api/v2/workspaces/1/nodes/2/update"]; n != 3 {
+		t.Errorf("expected UpdateNode to be retried, got %d attempts", n)
+	}
+	_ = client.StopNode(ctx, 1, 2)
+	if n := attempts["/api/v1/workspaces/1/nodes/2/stop"]; n != 3 {
+		t.Errorf("expected StopNode to be retried, got %d attempts", n)
+	}
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// defaultProfile is the profile `onf setup` writes when no --profile is given.
+const defaultProfile = "default"
+
+// profileCredentials is a single section of the credentials file written by
+// the onf CLI (`onf setup`), usually found at ~/.onf/credentials.
+type profileCredentials struct {
+	AccessKey   string `ini:"onf_access_key"`
+	SecretKey   string `ini:"onf_secret_key"`
+	WorkspaceId uint64 `ini:"default_workspace"`
+}
+
+// credentialsFilePath returns the location of the onf CLI credentials file,
+// which can be overridden with env ONFINALITY_CREDENTIALS_FILE.
+func credentialsFilePath() (string, error) {
+	if v := os.Getenv("ONFINALITY_CREDENTIALS_FILE"); v != "" {
+		return v, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".onf", "credentials"), nil
+}
+
+// loadProfileCredentials reads the named profile from the credentials file.
+// The onf CLI stores the default profile in the unnamed ini section, so
+// "default" is matched against it as well.
+func loadProfileCredentials(file string, profile string) (*profileCredentials, error) {
+	cfg, err := ini.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range cfg.Sections() {
+		if !strings.EqualFold(section.Name(), profile) {
+			continue
+		}
+		creds := &profileCredentials{}
+		if err := section.MapTo(creds); err != nil {
+			return nil, fmt.Errorf("unable to parse profile %q: %w", profile, err)
+		}
+		creds.AccessKey = strings.TrimSpace(creds.AccessKey)
+		creds.SecretKey = strings.TrimSpace(creds.SecretKey)
+		return creds, nil
+	}
+	return nil, fmt.Errorf("profile %q not found", profile)
+}
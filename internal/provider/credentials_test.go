@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+const testCredentialsFile = `onf_access_key = default-access
+onf_secret_key = default-secret
+default_workspace = 6635707676612587520
+
+[ci]
+onf_access_key = ci-access
+onf_secret_key = ci-secret
+`
+
+func writeTestCredentials(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(file, []byte(testCredentialsFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadProfileCredentials(t *testing.T) {
+	file := writeTestCredentials(t)
+
+	creds, err := loadProfileCredentials(file, defaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "default-access" || creds.SecretKey != "default-secret" || creds.WorkspaceId != 6635707676612587520 {
+		t.Errorf("unexpected default profile: %+v", creds)
+	}
+
+	creds, err = loadProfileCredentials(file, "ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKey != "ci-access" || creds.SecretKey != "ci-secret" {
+		t.Errorf("unexpected ci profile: %+v", creds)
+	}
+
+	if _, err = loadProfileCredentials(file, "missing"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv("ONFINALITY_CREDENTIALS_FILE", writeTestCredentials(t))
+	t.Setenv("ONFINALITY_ACCESS_KEY", "")
+	t.Setenv("ONFINALITY_SECRET_KEY", "")
+	t.Setenv("ONFINALITY_PROFILE", "ci")
+
+	data := providerData{}
+	data.AccessKey.Null = true
+	data.SecretKey.Null = true
+	data.Profile.Null = true
+
+	var diags diag.Diagnostics
+	accessKey, secretKey, workspaceId := resolveCredentials(data, &diags)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if accessKey != "ci-access" || secretKey != "ci-secret" || workspaceId != 0 {
+		t.Errorf("unexpected credentials %q %q %d", accessKey, secretKey, workspaceId)
+	}
+
+	data.Profile = types.String{Value: "default"}
+	accessKey, secretKey, workspaceId = resolveCredentials(data, &diags)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if accessKey != "default-access" || secretKey != "default-secret" || workspaceId != 6635707676612587520 {
+		t.Errorf("unexpected credentials %q %q %d", accessKey, secretKey, workspaceId)
+	}
+
+	t.Setenv("ONFINALITY_ACCESS_KEY", "env-access")
+	t.Setenv("ONFINALITY_SECRET_KEY", "env-secret")
+	accessKey, secretKey, workspaceId = resolveCredentials(data, &diags)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	// default_workspace only comes with the keys of the profile
+	if accessKey != "env-access" || secretKey != "env-secret" || workspaceId != 0 {
+		t.Errorf("unexpected credentials %q %q %d", accessKey, secretKey, workspaceId)
+	}
+
+	data.AccessKey = types.String{Value: "config-access"}
+	data.SecretKey = types.String{Value: "config-secret"}
+	data.Profile = types.String{Value: "missing"}
+	accessKey, secretKey, _ = resolveCredentials(data, &diags)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if accessKey != "config-access" || secretKey != "config-secret" {
+		t.Errorf("unexpected credentials %q %q", accessKey, secretKey)
+	}
+
+	// keys are never taken from different sources
+	data.AccessKey = types.String{Null: true}
+	resolveCredentials(data, &diags)
+	if !diags.HasError() || diags.Errors()[0].Summary() != "Incomplete OnFinality Credentials" {
+		t.Errorf("expected an error for a secret_key without access_key, got %v", diags)
+	}
+
+	diags = nil
+	data.SecretKey = types.String{Null: true}
+	t.Setenv("ONFINALITY_SECRET_KEY", "")
+	resolveCredentials(data, &diags)
+	if !diags.HasError() || diags.Errors()[0].Summary() != "Incomplete OnFinality Credentials" {
+		t.Errorf("expected an error for env ONFINALITY_ACCESS_KEY without ONFINALITY_SECRET_KEY, got %v", diags)
+	}
+
+	diags = nil
+	t.Setenv("ONFINALITY_ACCESS_KEY", "")
+	resolveCredentials(data, &diags)
+	if !diags.HasError() {
+		t.Error("expected an error for a missing profile")
+	}
+}
+
+func TestProviderWorkspaceFromProfile(t *testing.T) {
+	t.Setenv("ONFINALITY_CREDENTIALS_FILE", writeTestCredentials(t))
+	t.Setenv("ONFINALITY_ACCESS_KEY", "")
+	t.Setenv("ONFINALITY_SECRET_KEY", "")
+	t.Setenv("ONFINALITY_PROFILE", "")
+	t.Setenv("ONFINALITY_WORKSPACE_ID", "")
+
+	data := testProviderData(newFakeApi(t), "")
+	data.AccessKey = types.String{Null: true}
+	data.SecretKey = types.String{Null: true}
+	data.WorkspaceId = types.Int64{Null: true}
+	data.SkipCredentialsValidation = types.Bool{Value: true}
+	p, diags := configureProvider(t, data)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	if ws := p.(*onfinalityProvider).workspaceId; ws != 6635707676612587520 {
+		t.Errorf("expected the profile's default_workspace, got %d", ws)
+	}
+
+	// the attribute and env take precedence
+	t.Setenv("ONFINALITY_WORKSPACE_ID", "20")
+	p, _ = configureProvider(t, data)
+	if ws := p.(*onfinalityProvider).workspaceId; ws != 20 {
+		t.Errorf("expected env ONFINALITY_WORKSPACE_ID, got %d", ws)
+	}
+	data.WorkspaceId = types.Int64{Value: 10}
+	p, _ = configureProvider(t, data)
+	if ws := p.(*onfinalityProvider).workspaceId; ws != 10 {
+		t.Errorf("expected the workspace_id attribute, got %d", ws)
+	}
+}
@@ -0,0 +1,315 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	onf "github.com/OnFinality-io/onf-cli/pkg/service"
+)
+
+var fakeNodePath = regexp.MustCompile(`^/api/v[12]/workspaces/(\d+)/nodes(?:/(\d+))?(?:/([a-z-]+))?$`)
+
+// fakeApi is an in-memory stand-in for the OnFinality API. Nodes move to
+// their target status straight away, so waits finish on the first poll.
+type fakeApi struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	nodes      map[uint64]*nodeDetail
+	workspaces []onf.Workspace
+	nextId     uint64
+	accessKeys map[string]int
+	// status, when set, is returned for every request instead of a result
+	status int
+	// createStatus is the status new nodes start in, "running" by default
+	createStatus string
+	// statusMessages are returned with the status of a node
+	statusMessages map[uint64]string
+	// statusPolls are returned by the next status requests of a node before
+	// its actual status
+	statusPolls map[uint64][]string
+	// staleUpdates leaves nodes unchanged by updates, like the API does
+	// until it has applied them
+	staleUpdates bool
+	// actionStatus overrides the status nodes end up in after an action,
+	// e.g. "update" to "error"
+	actionStatus map[string]string
+}
+
+func newFakeApi(t *testing.T) *fakeApi {
+	f := newUnstartedFakeApi()
+	f.Start()
+	t.Cleanup(f.Close)
+	return f
+}
+
+// newFakeTlsApi serves the fake API over HTTPS with a self-signed certificate.
+func newFakeTlsApi(t *testing.T) *fakeApi {
+	f := newUnstartedFakeApi()
+	f.StartTLS()
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newUnstartedFakeApi() *fakeApi {
+	f := &fakeApi{
+		nodes: map[uint64]*nodeDetail{},
+		workspaces: []onf.Workspace{
+			{ID: 10, Name: "team a", Plan: "enterprise", OwnerID: 1, Active: true},
+			{ID: 20, Name: "team b", Plan: "developer", OwnerID: 2, Active: true},
+		},
+		nextId:         1000,
+		accessKeys:     map[string]int{},
+		createStatus:   "running",
+		statusMessages: map[uint64]string{},
+		statusPolls:    map[uint64][]string{},
+		actionStatus:   map[string]string{},
+	}
+	f.Server = httptest.NewUnstartedServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// apiUrl is the value to use for the provider's api_url attribute.
+func (f *fakeApi) apiUrl() string {
+	return f.URL + "/api"
+}
+
+// addNode stores node as-is and returns it.
+func (f *fakeApi) addNode(node *nodeDetail) *nodeDetail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nodes[node.ID] = node
+	return node
+}
+
+// node returns a copy of the node with id, nil if there is none. Change
+// nodes with updateNode, requests may still be served concurrently.
+func (f *fakeApi) node(id uint64) *nodeDetail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	node, ok := f.nodes[id]
+	if !ok {
+		return nil
+	}
+	copied := *node
+	return &copied
+}
+
+// updateNode calls update with the node with id while holding the lock.
+func (f *fakeApi) updateNode(id uint64, update func(node *nodeDetail)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	update(f.nodes[id])
+}
+
+func (f *fakeApi) setNodeStatus(id uint64, status string) {
+	f.updateNode(id, func(node *nodeDetail) { node.Status = status })
+}
+
+// setStatus sets the status returned for every request, 0 to serve them.
+func (f *fakeApi) setStatus(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+func (f *fakeApi) setCreateStatus(status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.createStatus = status
+}
+
+func (f *fakeApi) setActionStatus(action string, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actionStatus[action] = status
+}
+
+func (f *fakeApi) setStatusMessage(id uint64, message string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statusMessages[id] = message
+}
+
+func (f *fakeApi) setStatusPolls(id uint64, polls ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statusPolls[id] = polls
+}
+
+func (f *fakeApi) setStaleUpdates(stale bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.staleUpdates = stale
+}
+
+// requestsBy returns how many requests were signed with accessKey.
+func (f *fakeApi) requestsBy(accessKey string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.accessKeys[accessKey]
+}
+
+func (f *fakeApi) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth := strings.TrimPrefix(r.Header.Get("authorization"), "ONF ")
+	f.accessKeys[strings.SplitN(auth, ":", 2)[0]]++
+
+	if f.status != 0 {
+		writeFakeError(w, f.status, http.StatusText(f.status))
+		return
+	}
+	if r.URL.Path == "/api/v1/workspaces" && r.Method == http.MethodGet {
+		writeFakeJson(w, f.workspaces)
+		return
+	}
+	if r.URL.Path == "/api/v1/info" && r.Method == http.MethodGet {
+		writeFakeJson(w, onf.Info{Clusters: []onf.Clusters{
+			{Name: "Japan", Hash: "jm", Cloud: "gcp", Region: "asia-northeast1", Active: true},
+			{Name: "London", Hash: "lz", Cloud: "aws", Region: "eu-west-2", Active: true},
+		}})
+		return
+	}
+
+	m := fakeNodePath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		writeFakeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	wsId, _ := strconv.ParseUint(m[1], 10, 64)
+	if m[2] == "" {
+		if r.Method == http.MethodGet {
+			f.listNodes(w, wsId)
+			return
+		}
+		if r.Method != http.MethodPost {
+			writeFakeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		f.createNode(w, r, wsId)
+		return
+	}
+
+	nodeId, _ := strconv.ParseUint(m[2], 10, 64)
+	node, ok := f.nodes[nodeId]
+	if !ok || node.WorkspaceID != wsId {
+		writeFakeError(w, http.StatusNotFound, "node not found")
+		return
+	}
+	switch action := m[3]; {
+	case action == "" && r.Method == http.MethodGet:
+		writeFakeJson(w, node)
+	case action == "" && r.Method == http.MethodDelete:
+		node.Status = "terminated"
+	case action == "status":
+		status := node.Status
+		if polls := f.statusPolls[nodeId]; len(polls) > 0 {
+			status, f.statusPolls[nodeId] = polls[0], polls[1:]
+		}
+		writeFakeJson(w, nodeStatus{Status: status, Message: f.statusMessages[nodeId]})
+	case action == "stop":
+		node.Status = "stopped"
+	case action == "resume":
+		node.Status = "running"
+	case action == "expand-storage":
+		var payload map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		node.Storage = payload["storage"]
+	case action == "update" && f.staleUpdates:
+	case action == "update":
+		var payload onf.UpdateNodePayload
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload.NodeName != nil {
+			node.Name = *payload.NodeName
+		}
+		if payload.NodeType != nil {
+			node.NodeType = *payload.NodeType
+		}
+		if payload.NodeSpec != nil {
+			node.NodeSpec = payload.NodeSpec.Key
+			node.NodeSpecMultiplier = float32(payload.NodeSpec.Multiplier)
+		}
+		if payload.ImageVersion != nil {
+			node.Image = strings.Split(node.Image, ":")[0] + ":" + *payload.ImageVersion
+		}
+	default:
+		writeFakeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if status, ok := f.actionStatus[m[3]]; ok {
+		node.Status = status
+	}
+}
+
+func (f *fakeApi) listNodes(w http.ResponseWriter, wsId uint64) {
+	list := []onf.NodeItem{}
+	for _, node := range f.nodes {
+		if node.WorkspaceID == wsId {
+			list = append(list, onf.NodeItem{ID: node.ID, Name: node.Name, NetworkSpecKey: node.NetworkSpecKey, ClusterHash: node.ClusterHash, Status: node.Status, Image: node.Image})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	writeFakeJson(w, list)
+}
+
+func (f *fakeApi) createNode(w http.ResponseWriter, r *http.Request, wsId uint64) {
+	var payload onf.CreateNodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.nextId++
+	node := &nodeDetail{Node: onf.Node{
+		ID:                 f.nextId,
+		Name:               payload.NodeName,
+		NetworkSpecKey:     payload.NetworkSpecKey,
+		WorkspaceID:        wsId,
+		NodeType:           string(payload.NodeType),
+		NodeSpec:           payload.NodeSpec.Key,
+		NodeSpecMultiplier: float32(payload.NodeSpec.Multiplier),
+		Storage:            *payload.Storage,
+		Image:              fmt.Sprintf("onfinality/%s:%s", payload.NetworkSpecKey, *payload.ImageVersion),
+		ClusterHash:        payload.ClusterHash,
+		Status:             f.createStatus,
+		OwnerID:            1,
+		CPU:                fmt.Sprintf("%dm", 500*payload.NodeSpec.Multiplier),
+		Ram:                fmt.Sprintf("%dMi", 1536*payload.NodeSpec.Multiplier),
+	}}
+	node.CreatedAt = "2022-09-01T10:00:00Z"
+	node.UpdatedAt = node.CreatedAt
+	node.Endpoints = &onf.Endpoints{
+		RPC: fmt.Sprintf("https://%s.api.onfinality.io/rpc", payload.NetworkSpecKey),
+		WS:  fmt.Sprintf("wss://%s.api.onfinality.io/ws", payload.NetworkSpecKey),
+		P2p: fmt.Sprintf("/dns4/node-%d.onfinality.io/tcp/30333/p2p/12D3KooWfake", node.ID),
+	}
+	if payload.UseApiKey {
+		node.Endpoints.RPC += fmt.Sprintf("?apikey=key-%d", node.ID)
+		node.Endpoints.WS += fmt.Sprintf("?apikey=key-%d", node.ID)
+	}
+	node.InitFromBackup = &payload.InitFromBackup
+	node.UseApiKey = &payload.UseApiKey
+	node.PublicPort = &payload.PublicPort
+	f.nodes[node.ID] = node
+	writeFakeJson(w, node)
+}
+
+func writeFakeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
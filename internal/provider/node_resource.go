@@ -5,14 +5,14 @@ import (
 	"fmt"
 	"github.com/OnFinality-io/onf-cli/pkg/models"
 	onf "github.com/OnFinality-io/onf-cli/pkg/service"
-	"github.com/OnFinality-io/onf-cli/pkg/watcher"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-log/tflog"
-	k8sResource "k8s.io/apimachinery/pkg/api/resource"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -22,23 +22,67 @@ import (
 var _ provider.ResourceType = onFinalityNode{}
 var _ resource.Resource = nodeResource{}
 var _ resource.ResourceWithImportState = nodeResource{}
+var _ resource.ResourceWithModifyPlan = nodeResource{}
 
 type nodeSpec struct {
 	Key        types.String `tfsdk:"key"`
 	Multiplier types.Int64  `tfsdk:"multiplier"`
 }
+type nodeTimeouts struct {
+	Create types.String `tfsdk:"create"`
+	Update types.String `tfsdk:"update"`
+	Delete types.String `tfsdk:"delete"`
+}
+
+// nodeTimeoutsBlock is the timeouts block, it holds at most one nodeTimeouts.
+type nodeTimeoutsBlock []nodeTimeouts
+
+const (
+	defaultCreateTimeout = 30 * time.Minute
+	defaultUpdateTimeout = 30 * time.Minute
+	defaultDeleteTimeout = 15 * time.Minute
+)
+
+// transitionalStatuses are the statuses a node passes through while the API
+// works on it, as in the onf CLI.
+var transitionalStatuses = []string{"pending", "processing", "initializing", "restarting", "stopping"}
+
+// pendingStatuses returns the statuses to accept on the way to a target: the
+// transitional ones and from, the statuses the node starts in.
+func pendingStatuses(from ...string) []string {
+	return append(append([]string{}, transitionalStatuses...), from...)
+}
+
 type onFinalityNode struct {
-	WorkspaceId    types.Int64  `tfsdk:"workspace_id"`
-	Id             types.Int64  `tfsdk:"id"`
-	NetworkSpecKey types.String `tfsdk:"network_spec_key"`
-	NodeSpec       nodeSpec     `tfsdk:"node_spec"`
-	NodeType       types.String `tfsdk:"node_type"`
-	NodeName       types.String `tfsdk:"node_name"`
-	ClusterHash    types.String `tfsdk:"cluster_hash"`
-	Storage        types.String `tfsdk:"storage"`
-	ImageVersion   types.String `tfsdk:"image_version"`
-	Image          types.String `tfsdk:"image"`
-	Stopped        types.Bool   `tfsdk:"stopped"`
+	WorkspaceId            types.Int64       `tfsdk:"workspace_id"`
+	Id                     types.Int64       `tfsdk:"id"`
+	NetworkSpecKey         types.String      `tfsdk:"network_spec_key"`
+	NodeSpec               nodeSpec          `tfsdk:"node_spec"`
+	NodeType               types.String      `tfsdk:"node_type"`
+	NodeName               types.String      `tfsdk:"node_name"`
+	ClusterHash            types.String      `tfsdk:"cluster_hash"`
+	Storage                Quantity          `tfsdk:"storage"`
+	ImageVersion           types.String      `tfsdk:"image_version"`
+	Image                  types.String      `tfsdk:"image"`
+	Stopped                types.Bool        `tfsdk:"stopped"`
+	RpcEndpoint            types.String      `tfsdk:"rpc_endpoint"`
+	WsEndpoint             types.String      `tfsdk:"ws_endpoint"`
+	P2pEndpoint            types.String      `tfsdk:"p2p_endpoint"`
+	ApiKey                 types.String      `tfsdk:"api_key"`
+	Status                 types.String      `tfsdk:"status"`
+	CreatedAt              types.String      `tfsdk:"created_at"`
+	UpdatedAt              types.String      `tfsdk:"updated_at"`
+	Owner                  types.Int64       `tfsdk:"owner"`
+	Region                 types.String      `tfsdk:"region"`
+	Cloud                  types.String      `tfsdk:"cloud"`
+	Cpu                    types.String      `tfsdk:"cpu"`
+	Memory                 types.String      `tfsdk:"memory"`
+	InitFromBackup         types.Bool        `tfsdk:"init_from_backup"`
+	UseApiKey              types.Bool        `tfsdk:"use_api_key"`
+	PublicPort             types.Bool        `tfsdk:"public_port"`
+	PreventReplace         types.Bool        `tfsdk:"prevent_replace"`
+	ReplaceOnStorageShrink types.Bool        `tfsdk:"replace_on_storage_shrink"`
+	Timeouts               nodeTimeoutsBlock `tfsdk:"timeouts"`
 }
 
 func (t onFinalityNode) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Diagnostics) {
@@ -63,14 +107,17 @@ resource "onfinality_node" "n1" {
 
 		Attributes: map[string]tfsdk.Attribute{
 			"workspace_id": {
-				MarkdownDescription: "Workspace id, can get it from url https://app.onfinality.io/workspaces/<workspace_id>/nodes",
-				Required:            true,
+				MarkdownDescription: "Workspace id, can get it from url https://app.onfinality.io/workspaces/<workspace_id>/nodes. Defaults to the provider's workspace_id",
+				Optional:            true,
+				Computed:            true,
 				Type:                types.Int64Type,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{ReplaceUnlessPreventedModifier()},
 			},
 			"network_spec_key": {
 				MarkdownDescription: "Network of the node, can get from `onf network-spec list` & `onf network-spec list-backups`",
 				Required:            true,
 				Type:                types.StringType,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{ReplaceUnlessPreventedModifier()},
 			},
 			"node_spec": {
 				MarkdownDescription: "Node Spec of the node, always put key=\"unit\", 1 * unit ~ 0.5 cpu 1.5G mem",
@@ -94,11 +141,12 @@ resource "onfinality_node" "n1" {
 				MarkdownDescription: "Cluster where the node will be deployed, check `onf info cluster` for all available clusters",
 				Required:            true,
 				Type:                types.StringType,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{ReplaceUnlessPreventedModifier()},
 			},
 			"storage": {
-				MarkdownDescription: "Disk size of the node, <num>Gi , e.g 100Gi",
+				MarkdownDescription: "Disk size of the node, <num>Gi , e.g 100Gi. Equal sizes in other units, e.g 102400Mi, don't cause a diff",
 				Required:            true,
-				Type:                types.StringType,
+				Type:                QuantityType,
 			},
 			"image_version": {
 				MarkdownDescription: "Image Version to use",
@@ -125,10 +173,166 @@ resource "onfinality_node" "n1" {
 				Computed:            true,
 				Type:                types.BoolType,
 			},
+			"rpc_endpoint": {
+				MarkdownDescription: "HTTPS RPC endpoint of the node",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"ws_endpoint": {
+				MarkdownDescription: "WSS endpoint of the node",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"p2p_endpoint": {
+				MarkdownDescription: "P2P multiaddr of the node",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"api_key": {
+				MarkdownDescription: "API key for the node's endpoints, when `use_api_key` is set. It's removed from `rpc_endpoint` and `ws_endpoint`, pass it as the `apikey` query parameter",
+				Computed:            true,
+				Sensitive:           true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"status": {
+				MarkdownDescription: "Status of the node, e.g. `running`, `stopped` or `error`",
+				Computed:            true,
+				Type:                types.StringType,
+			},
+			"created_at": {
+				MarkdownDescription: "When the node was created",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"updated_at": {
+				MarkdownDescription: "When the node was last updated",
+				Computed:            true,
+				Type:                types.StringType,
+			},
+			"owner": {
+				MarkdownDescription: "Id of the user who owns the node",
+				Computed:            true,
+				Type:                types.Int64Type,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"region": {
+				MarkdownDescription: "Region of the node's cluster",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"cloud": {
+				MarkdownDescription: "Cloud provider of the node's cluster",
+				Computed:            true,
+				Type:                types.StringType,
+				PlanModifiers:       tfsdk.AttributePlanModifiers{resource.UseStateForUnknown()},
+			},
+			"cpu": {
+				MarkdownDescription: "CPU of the node, resolved from `node_spec`",
+				Computed:            true,
+				Type:                types.StringType,
+			},
+			"memory": {
+				MarkdownDescription: "Memory of the node, resolved from `node_spec`",
+				Computed:            true,
+				Type:                types.StringType,
+			},
+			"init_from_backup": {
+				MarkdownDescription: "Restore the node from the latest backup of the network instead of syncing from genesis, defaults to `true`",
+				Optional:            true,
+				Computed:            true,
+				Type:                types.BoolType,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{BoolDefaultModifier(true), ReplaceUnlessPreventedModifier()},
+			},
+			"use_api_key": {
+				MarkdownDescription: "Require an API key on the node's endpoints, defaults to `true`",
+				Optional:            true,
+				Computed:            true,
+				Type:                types.BoolType,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{BoolDefaultModifier(true), ReplaceUnlessPreventedModifier()},
+			},
+			"public_port": {
+				MarkdownDescription: "Expose the node's p2p port publicly, defaults to `true`",
+				Optional:            true,
+				Computed:            true,
+				Type:                types.BoolType,
+				PlanModifiers:       []tfsdk.AttributePlanModifier{BoolDefaultModifier(true), ReplaceUnlessPreventedModifier()},
+			},
+			"prevent_replace": {
+				MarkdownDescription: "Set to true to fail the plan instead of replacing the node when `workspace_id`, `network_spec_key`, `cluster_hash`, `init_from_backup`, `use_api_key` or `public_port` changes",
+				Optional:            true,
+				Type:                types.BoolType,
+			},
+			"replace_on_storage_shrink": {
+				MarkdownDescription: "Node storage can't shrink, so a smaller `storage` fails the plan. Set to true to replace the node instead, losing its data",
+				Optional:            true,
+				Type:                types.BoolType,
+			},
+		},
+		Blocks: map[string]tfsdk.Block{
+			"timeouts": {
+				MarkdownDescription: "How long to wait for the node to reach the expected status, as a duration such as `30s`, `10m` or `1h`",
+				NestingMode:         tfsdk.BlockNestingModeList,
+				MaxItems:            1,
+				Attributes: map[string]tfsdk.Attribute{
+					"create": {
+						MarkdownDescription: fmt.Sprintf("Timeout for creating the node, defaults to `%s`", defaultCreateTimeout),
+						Optional:            true,
+						Type:                types.StringType,
+						Validators:          []tfsdk.AttributeValidator{DurationValidator()},
+					},
+					"update": {
+						MarkdownDescription: fmt.Sprintf("Timeout for updating, stopping, resuming or expanding the storage of the node, defaults to `%s`", defaultUpdateTimeout),
+						Optional:            true,
+						Type:                types.StringType,
+						Validators:          []tfsdk.AttributeValidator{DurationValidator()},
+					},
+					"delete": {
+						MarkdownDescription: fmt.Sprintf("Timeout for terminating the node, defaults to `%s`", defaultDeleteTimeout),
+						Optional:            true,
+						Type:                types.StringType,
+						Validators:          []tfsdk.AttributeValidator{DurationValidator()},
+					},
+				},
+			},
 		},
 	}, nil
 }
 
+// timeout returns the configured duration, or def when it isn't set.
+func (b nodeTimeoutsBlock) timeout(value func(nodeTimeouts) types.String, def time.Duration) time.Duration {
+	if len(b) == 0 {
+		return def
+	}
+	v := value(b[0])
+	if v.IsNull() || v.IsUnknown() {
+		return def
+	}
+	d, err := time.ParseDuration(v.Value)
+	if err != nil || d <= 0 {
+		// rejected by DurationValidator at plan time
+		return def
+	}
+	return d
+}
+
+func (b nodeTimeoutsBlock) create() time.Duration {
+	return b.timeout(func(t nodeTimeouts) types.String { return t.Create }, defaultCreateTimeout)
+}
+
+func (b nodeTimeoutsBlock) update() time.Duration {
+	return b.timeout(func(t nodeTimeouts) types.String { return t.Update }, defaultUpdateTimeout)
+}
+
+func (b nodeTimeoutsBlock) delete() time.Duration {
+	return b.timeout(func(t nodeTimeouts) types.String { return t.Delete }, defaultDeleteTimeout)
+}
+
 func (t onFinalityNode) NewResource(ctx context.Context, in provider.Provider) (resource.Resource, diag.Diagnostics) {
 	provider, diags := convertProviderType(in)
 
@@ -139,55 +343,172 @@ func (t onFinalityNode) NewResource(ctx context.Context, in provider.Provider) (
 
 type nodeResource struct {
 	provider onfinalityProvider
+
+	// pollInterval overrides defaultPollInterval in tests.
+	pollInterval time.Duration
 }
 
 func (r nodeResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
 	var data onFinalityNode
-	diags := req.Config.Get(ctx, &data)
+	diags := req.Plan.Get(ctx, &data)
 	resp.Diagnostics.Append(diags...)
 
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// If applicable, this is a great opportunity to initialize any necessary
-	// provider client data and make a call using it.
-	// example, err := d.provider.client.CreateExample(...)
-	// if err != nil {
-	//     resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create example, got error: %s", err))
-	//     return
-	// }
-
-	// For the purposes of this example code, hardcoding a response value to
-	// save into the Terraform state.
-	node, err := onf.CreateNode(uint64(data.WorkspaceId.Value), &onf.CreateNodePayload{
+	node, err := r.provider.client.CreateNode(ctx, uint64(data.WorkspaceId.Value), &onf.CreateNodePayload{
 		NetworkSpecKey: data.NetworkSpecKey.Value,
 		NodeSpec:       &onf.NodeSpec{Key: data.NodeSpec.Key.Value, Multiplier: int(data.NodeSpec.Multiplier.Value)},
 		NodeType:       models.NodeType(data.NodeType.Value),
 		NodeName:       data.NodeName.Value,
 		ClusterHash:    data.ClusterHash.Value,
 		Storage:        &data.Storage.Value,
-		InitFromBackup: true,
-		UseApiKey:      true,
+		InitFromBackup: data.InitFromBackup.Value,
+		UseApiKey:      data.UseApiKey.Value,
 		ImageVersion:   &data.ImageVersion.Value,
-		PublicPort:     true,
+		PublicPort:     data.PublicPort.Value,
 	})
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to create node, got error: %s", err))
 		return
 	}
+	stopped := data.Stopped.Value && !data.Stopped.IsUnknown()
 	data.Id = types.Int64{Value: int64(node.ID)}
 	data.Image = types.String{Value: node.Image}
 	data.Stopped = types.Bool{Value: false}
+	cluster := r.nodeCluster(ctx, data.ClusterHash.Value)
+	applyNodeComputed(&data, node, cluster)
+	tflog.Trace(ctx, "created node", map[string]interface{}{"id": node.ID})
 
-	// Write logs using the tflog package
-	// Documentation: https://terraform.io/plugin/log
-	// tflog.Trace(ctx, "created a resource")
+	// Record the node straight away, so if it never becomes running below
+	// Terraform taints it instead of losing track of it.
+	diags = resp.State.Set(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !r.waitForNodeStatus(ctx, data, data.Timeouts.create(), "running", pendingStatuses(), &resp.Diagnostics) {
+		return
+	}
+
+	if stopped {
+		err = r.provider.client.StopNode(ctx, uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+		if err != nil {
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to stop node, got error: %s", err))
+			return
+		}
+		if !r.waitForNodeStatus(ctx, data, data.Timeouts.create(), "stopped", pendingStatuses("running"), &resp.Diagnostics) {
+			return
+		}
+		data.Stopped = types.Bool{Value: true}
+	}
+
+	node, err = r.provider.client.GetNodeDetail(ctx, uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to get node, got error: %s", err))
+		return
+	}
+	data.Image = types.String{Value: node.Image}
+	applyNodeComputed(&data, node, cluster)
 
 	diags = resp.State.Set(ctx, &data)
 	resp.Diagnostics.Append(diags...)
 }
 
+// ModifyPlan fills in the planned workspace_id and checks the storage change,
+// so nothing is applied to a node whose plan can't succeed.
+func (r nodeResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() {
+		// if we're deleting the resource, there is nothing to fill in
+		return
+	}
+
+	r.modifyPlanWorkspaceId(ctx, req, resp)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	r.modifyPlanStorage(ctx, req, resp)
+}
+
+// modifyPlanWorkspaceId fills in workspace_id from the provider's default when
+// the configuration omits it, so the effective workspace is recorded in state.
+// As the workspace can't be updated, a new default replaces existing nodes.
+func (r nodeResource) modifyPlanWorkspaceId(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	var workspaceId types.Int64
+	diags := req.Config.GetAttribute(ctx, path.Root("workspace_id"), &workspaceId)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() || !workspaceId.IsNull() {
+		return
+	}
+
+	if r.provider.workspaceId != 0 {
+		workspaceId = types.Int64{Value: r.provider.workspaceId}
+	} else if !req.State.Raw.IsNull() {
+		diags = req.State.GetAttribute(ctx, path.Root("workspace_id"), &workspaceId)
+		resp.Diagnostics.Append(diags...)
+	} else {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("workspace_id"),
+			"Missing Workspace Id",
+			"Set workspace_id on the resource, or set workspace_id (or env ONFINALITY_WORKSPACE_ID) on the provider.",
+		)
+		return
+	}
+	diags = resp.Plan.SetAttribute(ctx, path.Root("workspace_id"), workspaceId)
+	resp.Diagnostics.Append(diags...)
+
+	if req.State.Raw.IsNull() {
+		return
+	}
+	var stateWorkspaceId types.Int64
+	diags = req.State.GetAttribute(ctx, path.Root("workspace_id"), &stateWorkspaceId)
+	resp.Diagnostics.Append(diags...)
+	if !workspaceId.Equal(stateWorkspaceId) && requireReplace(ctx, req.Config, path.Root("workspace_id"), &resp.Diagnostics) {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("workspace_id"))
+	}
+}
+
+// modifyPlanStorage rejects shrinking the storage, which the API doesn't
+// support, or replaces the node instead when replace_on_storage_shrink is set.
+func (r nodeResource) modifyPlanStorage(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.State.Raw.IsNull() {
+		return
+	}
+	// only the attributes used here, others such as node_spec may be unknown
+	var planStorage, stateStorage Quantity
+	var replaceOnShrink types.Bool
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("storage"), &planStorage)...)
+	resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("storage"), &stateStorage)...)
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("replace_on_storage_shrink"), &replaceOnShrink)...)
+	if resp.Diagnostics.HasError() || planStorage.IsUnknown() || planStorage.SemanticallyEqual(stateStorage) {
+		return
+	}
+
+	planSize, err := planStorage.Quantity()
+	if err != nil {
+		// rejected by QuantityType at plan time
+		return
+	}
+	stateSize, err := stateStorage.Quantity()
+	if err != nil || stateSize.Cmp(planSize) <= 0 {
+		return
+	}
+
+	if !replaceOnShrink.Value {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("storage"),
+			"Unable To Shrink Storage",
+			fmt.Sprintf("Node storage can only grow, from %s to %s is a shrink. Keep the storage at least %s, or set replace_on_storage_shrink to replace the node with a new, smaller one.", stateStorage.Value, planStorage.Value, stateStorage.Value),
+		)
+		return
+	}
+	if requireReplace(ctx, req.Config, path.Root("storage"), &resp.Diagnostics) {
+		resp.RequiresReplace = append(resp.RequiresReplace, path.Root("storage"))
+	}
+}
+
 func (r nodeResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
 	var data onFinalityNode
 
@@ -198,14 +519,12 @@ func (r nodeResource) Read(ctx context.Context, req resource.ReadRequest, resp *
 		return
 	}
 
-	// If applicable, this is a great opportunity to initialize any necessary
-	// provider client data and make a call using it.
-	// example, err := d.provider.client.ReadExample(...)
-	// if err != nil {
-	//     resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to read example, got error: %s", err))
-	//     return
-	// }
-	node, err := onf.GetNodeDetail(uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	node, err := r.provider.client.GetNodeDetail(ctx, uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	if isNotFound(err) {
+		tflog.Info(ctx, "Node no longer exists", map[string]interface{}{"id": data.Id.Value})
+		resp.State.RemoveResource(ctx)
+		return
+	}
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to get node, got error: %s", err))
 		return
@@ -215,22 +534,127 @@ func (r nodeResource) Read(ctx context.Context, req resource.ReadRequest, resp *
 		resp.State.RemoveResource(ctx)
 		return
 	}
+	applyNodeDetail(&data, node, r.nodeCluster(ctx, node.ClusterHash))
+
+	diags = resp.State.Set(ctx, &data)
+	resp.Diagnostics.Append(diags...)
+}
+
+// applyNodeDetail copies the attributes the API reports for a node onto data,
+// so changes made outside Terraform, e.g. in the OnFinality console, show up
+// as drift. Read and ImportState both map nodes with it.
+func applyNodeDetail(data *onFinalityNode, node *nodeDetail, cluster *onf.Clusters) {
 	imageSlice := strings.Split(node.Image, ":")
+	data.Id = types.Int64{Value: int64(node.ID)}
+	data.WorkspaceId = types.Int64{Value: int64(node.WorkspaceID)}
+	data.NetworkSpecKey = types.String{Value: node.NetworkSpecKey}
+	data.ClusterHash = types.String{Value: node.ClusterHash}
 	data.NodeSpec = nodeSpec{
 		Key:        types.String{Value: node.NodeSpec},
 		Multiplier: types.Int64{Value: int64(node.NodeSpecMultiplier)},
 	}
 	data.NodeType = types.String{Value: node.NodeType}
 	data.NodeName = types.String{Value: node.Name}
-	data.Storage = types.String{Value: node.Storage}
+	if storage := (Quantity{Value: node.Storage}); !storage.SemanticallyEqual(data.Storage) {
+		// keep the configured unit when the API reports the size in another one
+		data.Storage = storage
+	}
 	data.Image = types.String{Value: node.Image}
 	data.ImageVersion = types.String{Value: imageSlice[len(imageSlice)-1]}
+	data.Stopped = types.Bool{Value: node.Status == "stopped"}
+	applyNodeComputed(data, node, cluster)
+	data.InitFromBackup = nodeOption(node.InitFromBackup, data.InitFromBackup)
+	data.UseApiKey = nodeOption(node.UseApiKey, data.UseApiKey)
+	data.PublicPort = nodeOption(node.PublicPort, data.PublicPort)
+}
 
-	if node.Status == "stopped" {
-		data.Stopped = types.Bool{Value: true}
+// applyNodeComputed copies the read-only attributes of node and its cluster
+// onto data. Connection details are null until the API assigns them. Without
+// cluster the region and cloud are kept, or null if they were never known.
+func applyNodeComputed(data *onFinalityNode, node *nodeDetail, cluster *onf.Clusters) {
+	var endpoints onf.Endpoints
+	if node.Endpoints != nil {
+		endpoints = *node.Endpoints
 	}
-	diags = resp.State.Set(ctx, &data)
-	resp.Diagnostics.Append(diags...)
+	rpc, rpcKey := splitEndpointApiKey(endpoints.RPC)
+	ws, wsKey := splitEndpointApiKey(endpoints.WS)
+	data.RpcEndpoint = optionalString(rpc)
+	data.WsEndpoint = optionalString(ws)
+	data.P2pEndpoint = optionalString(endpoints.P2p)
+	if rpcKey == "" {
+		rpcKey = wsKey
+	}
+	data.ApiKey = optionalString(rpcKey)
+
+	data.Status = types.String{Value: node.Status}
+	data.CreatedAt = optionalString(node.CreatedAt)
+	data.UpdatedAt = optionalString(node.UpdatedAt)
+	data.Owner = types.Int64{Value: int64(node.OwnerID)}
+	data.Cpu = optionalString(node.CPU)
+	data.Memory = optionalString(node.Ram)
+	if cluster != nil {
+		data.Region = optionalString(cluster.Region)
+		data.Cloud = optionalString(cluster.Cloud)
+	}
+	if data.Region.IsUnknown() {
+		data.Region = types.String{Null: true}
+	}
+	if data.Cloud.IsUnknown() {
+		data.Cloud = types.String{Null: true}
+	}
+}
+
+// nodeCluster looks up the cluster with hash, nil when it can't be found.
+func (r nodeResource) nodeCluster(ctx context.Context, hash string) *onf.Clusters {
+	clusters, err := r.provider.clusters.get(ctx, r.provider.client)
+	if err != nil {
+		tflog.Warn(ctx, "Unable to get clusters", map[string]interface{}{"error": err.Error()})
+		return nil
+	}
+	for i := range clusters {
+		if clusters[i].Hash == hash {
+			return &clusters[i]
+		}
+	}
+	return nil
+}
+
+// splitEndpointApiKey removes the apikey query parameter the API adds to the
+// endpoints of nodes using an API key, so the key only ends up in the
+// sensitive api_key attribute.
+func splitEndpointApiKey(endpoint string) (string, string) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.RawQuery == "" {
+		return endpoint, ""
+	}
+	query := u.Query()
+	key := query.Get("apikey")
+	if key == "" {
+		return endpoint, ""
+	}
+	query.Del("apikey")
+	u.RawQuery = query.Encode()
+	return u.String(), key
+}
+
+// optionalString returns null for an empty string.
+func optionalString(s string) types.String {
+	if s == "" {
+		return types.String{Null: true}
+	}
+	return types.String{Value: s}
+}
+
+// nodeOption returns the create option the API reports, or the prior value
+// when it doesn't. Without either the node was created with the default, true.
+func nodeOption(reported *bool, prior types.Bool) types.Bool {
+	if reported != nil {
+		return types.Bool{Value: *reported}
+	}
+	if !prior.IsNull() && !prior.IsUnknown() {
+		return prior
+	}
+	return types.Bool{Value: true}
 }
 
 func (r nodeResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
@@ -265,6 +689,43 @@ func (r nodeResource) Update(ctx context.Context, req resource.UpdateRequest, re
 		return
 	}
 
+	// ModifyPlan rejects shrinking the storage, check again before changing
+	// anything in case the plan didn't go through it.
+	expandStorage := false
+	if !state.Storage.SemanticallyEqual(plan.Storage) {
+		stateSize, err := state.Storage.Quantity()
+		if err != nil {
+			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to parse storage %s", state.Storage.Value))
+			return
+		}
+		planSize, err := plan.Storage.Quantity()
+		if err != nil {
+			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to parse storage %s", plan.Storage.Value))
+			return
+		}
+		if stateSize.Cmp(planSize) > 0 {
+			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to shrink node storage, "))
+			return
+		}
+		expandStorage = stateSize.Cmp(planSize) < 0
+	}
+
+	// From here on the node may change, so if anything fails record what the
+	// node actually looks like instead of the plan.
+	defer func() {
+		if resp.Diagnostics.HasError() {
+			actual := state
+			actual.Timeouts = plan.Timeouts
+			r.setActualNodeState(ctx, actual, &resp.State, &resp.Diagnostics)
+		}
+	}()
+
+	// updating or expanding a stopped node leaves it stopped
+	settled := "running"
+	if state.Stopped.Value {
+		settled = "stopped"
+	}
+
 	updatePayload := onf.UpdateNodePayload{}
 	needUpdate := false
 
@@ -290,86 +751,141 @@ func (r nodeResource) Update(ctx context.Context, req resource.UpdateRequest, re
 	}
 
 	if needUpdate {
-		err := onf.UpdateNode(uint64(state.WorkspaceId.Value), uint64(state.Id.Value), &updatePayload)
+		err := r.provider.client.UpdateNode(ctx, uint64(state.WorkspaceId.Value), uint64(state.Id.Value), &updatePayload)
 		if err != nil {
 			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to update node, got error: %s", err))
 			return
 		}
-		watch := &watcher.Watcher{Second: time.Duration(3)}
-		watch.Run(func(done chan bool) {
-			status, _ := onf.GetNodeStatus(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
-			if status.Status == "running" || status.Status == "error" {
-				//if status.Status == Running  {
-				done <- true
-			}
-		})
-	}
-
-	if state.Storage.Value != plan.Storage.Value {
-		stateSize, err := k8sResource.ParseQuantity(state.Storage.Value)
-		if err != nil {
-			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to parse storage %s", state.Storage.Value))
+		if !r.waitForNodeStatus(ctx, state, plan.Timeouts.update(), settled, pendingStatuses(), &resp.Diagnostics) {
 			return
 		}
-		planSize, err := k8sResource.ParseQuantity(plan.Storage.Value)
+	}
+
+	if expandStorage {
+		err := r.provider.client.ExpandNodeStorage(ctx, uint64(state.WorkspaceId.Value), uint64(state.Id.Value), plan.Storage.Value)
 		if err != nil {
-			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to parse storage %s", plan.Storage.Value))
+			resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to expand node storage, got error: %s", err))
 			return
 		}
-		if stateSize.Cmp(planSize) > 0 {
-			resp.Diagnostics.AddError("Param Error", fmt.Sprintf("Unable to shrink node storage, "))
+		if !r.waitForNodeStatus(ctx, state, plan.Timeouts.update(), settled, pendingStatuses(), &resp.Diagnostics) {
 			return
 		}
-		if stateSize.Cmp(planSize) < 0 {
-			err = onf.ExpandNodeStorage(uint64(state.WorkspaceId.Value), uint64(state.Id.Value), plan.Storage.Value)
-			if err != nil {
-				resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to expand node storage, got error: %s", err))
-				return
-			}
-			watch := &watcher.Watcher{Second: time.Duration(3)}
-			watch.Run(func(done chan bool) {
-				status, _ := onf.GetNodeStatus(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
-				if status.Status == "running" || status.Status == "error" {
-					//if status.Status == Running  {
-					done <- true
-				}
-			})
-		}
 	}
 
-	if state.Stopped.Value != plan.Stopped.Value {
+	// without stopped in the configuration it's planned unknown, leave the
+	// node as it is
+	if !plan.Stopped.IsUnknown() && state.Stopped.Value != plan.Stopped.Value {
 		if plan.Stopped.Value {
-			err := onf.StopNode(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
+			err := r.provider.client.StopNode(ctx, uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
 			if err != nil {
 				resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to stop node, got error: %s", err))
 				return
 			}
-			watch := &watcher.Watcher{Second: time.Duration(3)}
-			watch.Run(func(done chan bool) {
-				status, _ := onf.GetNodeStatus(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
-				if status.Status == "stopped" || status.Status == "error" {
-					done <- true
-				}
-			})
+			if !r.waitForNodeStatus(ctx, state, plan.Timeouts.update(), "stopped", pendingStatuses("running"), &resp.Diagnostics) {
+				return
+			}
 		} else {
-			err := onf.ResumeNode(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
+			err := r.provider.client.ResumeNode(ctx, uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
 			if err != nil {
 				resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to resume node, got error: %s", err))
 				return
 			}
-			watch := &watcher.Watcher{Second: time.Duration(3)}
-			watch.Run(func(done chan bool) {
-				status, _ := onf.GetNodeStatus(uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
-				if status.Status == "running" || status.Status == "error" {
-					done <- true
-				}
-			})
+			if !r.waitForNodeStatus(ctx, state, plan.Timeouts.update(), "running", pendingStatuses("stopped"), &resp.Diagnostics) {
+				return
+			}
 		}
 	}
+
+	node, err := r.provider.client.GetNodeDetail(ctx, uint64(state.WorkspaceId.Value), uint64(state.Id.Value))
+	if err != nil {
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to get node, got error: %s", err))
+		return
+	}
+	// like Create, the configured attributes are kept and the next Read
+	// reports any drift; the node may not reflect the update yet
+	if plan.Image.IsUnknown() {
+		plan.Image = types.String{Value: node.Image}
+	}
+	if plan.Stopped.IsUnknown() {
+		plan.Stopped = types.Bool{Value: node.Status == "stopped"}
+	}
+	applyNodeComputed(&plan, node, r.nodeCluster(ctx, plan.ClusterHash.Value))
+
 	diags = resp.State.Set(ctx, &plan)
 	resp.Diagnostics.Append(diags...)
 }
 
+// setActualNodeState refreshes node from the API and writes it to state, so a
+// failed apply leaves the node's real attributes in state. If the node can't be
+// read the state is left as it was.
+func (r nodeResource) setActualNodeState(ctx context.Context, node onFinalityNode, state *tfsdk.State, diags *diag.Diagnostics) {
+	detail, err := r.provider.client.GetNodeDetail(ctx, uint64(node.WorkspaceId.Value), uint64(node.Id.Value))
+	if err != nil {
+		tflog.Warn(ctx, "Unable to refresh node after a failed update", map[string]interface{}{"id": node.Id.Value, "error": err.Error()})
+		return
+	}
+	applyNodeDetail(&node, detail, r.nodeCluster(ctx, detail.ClusterHash))
+	diags.Append(state.Set(ctx, &node)...)
+}
+
+// waitForNodeStatus waits until the node's status is target, accepting the
+// pending statuses on the way, or any status if pending is empty. When the
+// node goes into error or another unexpected status, doesn't get to target
+// within timeout, or the apply is cancelled, it adds an error naming the last
+// observed status, and any reason the API gives for it, to diags and returns
+// false.
+func (r nodeResource) waitForNodeStatus(ctx context.Context, node onFinalityNode, timeout time.Duration, target string, pending []string, diags *diag.Diagnostics) bool {
+	var last *nodeStatus
+	// nodes in error can still be terminated
+	failed := []string{"error"}
+	if target == "terminated" {
+		failed = nil
+	}
+	waiter := statusWaiter{
+		Pending:      pending,
+		Target:       []string{target},
+		Failed:       failed,
+		PollInterval: r.pollInterval,
+		Timeout:      timeout,
+		Refresh: func(ctx context.Context) (string, error) {
+			status, err := r.provider.client.GetNodeStatus(ctx, uint64(node.WorkspaceId.Value), uint64(node.Id.Value))
+			if isNotFound(err) && target == "terminated" {
+				// terminated nodes are eventually purged
+				return target, nil
+			}
+			if err != nil {
+				return "", err
+			}
+			last = status
+			return status.Status, nil
+		},
+	}
+	lastStatus, err := waiter.Wait(ctx)
+	if err == nil {
+		return true
+	}
+	if _, ok := err.(*unexpectedStatusError); ok {
+		detail := fmt.Sprintf("Node %d went into %s status while waiting for it to become %s.", node.Id.Value, lastStatus, target)
+		if reason := last.failureReason(); reason != "" {
+			detail += fmt.Sprintf(" Reason: %s", reason)
+		}
+		diags.AddError("Node Error", detail)
+		return false
+	}
+	if _, ok := err.(*timeoutError); ok {
+		diags.AddError(
+			"Timeout Waiting For Node",
+			fmt.Sprintf("Node %d didn't become %s within %s, last observed status: %s", node.Id.Value, target, timeout, lastStatus),
+		)
+		return false
+	}
+	diags.AddError(
+		"Error Waiting For Node",
+		fmt.Sprintf("Stopped waiting for node %d to become %s, last observed status: %s, got error: %s", node.Id.Value, target, lastStatus, err),
+	)
+	return false
+}
+
 func (r nodeResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
 	var data onFinalityNode
 
@@ -380,59 +896,120 @@ func (r nodeResource) Delete(ctx context.Context, req resource.DeleteRequest, re
 		return
 	}
 
-	err := onf.TerminateNode(uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	status, err := r.provider.client.GetNodeStatus(ctx, uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	if isNotFound(err) || err == nil && status.Status == "terminated" {
+		tflog.Info(ctx, "Node has already been terminated")
+		return
+	}
+
+	err = r.provider.client.TerminateNode(ctx, uint64(data.WorkspaceId.Value), uint64(data.Id.Value))
+	if isNotFound(err) {
+		tflog.Info(ctx, "Node has already been terminated")
+		return
+	}
 	if err != nil {
-		tflog.Error(ctx, "delete node error:"+err.Error())
+		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to terminate node, got error: %s", err))
 		return
 	}
 
-	// If applicable, this is a great opportunity to initialize any necessary
-	// provider client data and make a call using it.
-	// example, err := d.provider.client.DeleteExample(...)
-	// if err != nil {
-	//     resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to delete example, got error: %s", err))
-	//     return
-	// }
+	r.waitForNodeStatus(ctx, data, data.Timeouts.delete(), "terminated", nil, &resp.Diagnostics)
 }
 
+// ImportState imports a node by "<workspace_id>:<node_id>", or by
+// "<workspace_id>:name=<node_name>" when the name is unique in the workspace.
 func (r nodeResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	idSlice := strings.Split(req.ID, ":")
-	wsId, err := strconv.ParseInt(idSlice[0], 10, 64)
+	wsId, nodeId, name, err := parseNodeImportId(req.ID)
 	if err != nil {
-		resp.Diagnostics.AddError("Id Error", fmt.Sprintf("Unable to convert wdId to int64, got error: %s", err))
+		resp.Diagnostics.AddError(
+			"Invalid Import Id",
+			fmt.Sprintf("%s. Import a node by \"<workspace_id>:<node_id>\", e.g. \"6635707676612587520:1234\", or by \"<workspace_id>:name=<node_name>\".", err),
+		)
 		return
 	}
-	id, err := strconv.ParseInt(idSlice[1], 10, 64)
-	if err != nil {
-		resp.Diagnostics.AddError("Id Error", fmt.Sprintf("Unable to convert nodeId to int64, got error: %s", err))
-		return
+	if name != "" {
+		var ok bool
+		if nodeId, ok = r.findNodeByName(ctx, wsId, name, &resp.Diagnostics); !ok {
+			return
+		}
 	}
 
-	node, err := onf.GetNodeDetail(uint64(wsId), uint64(id))
+	node, err := r.provider.client.GetNodeDetail(ctx, wsId, nodeId)
 	if err != nil {
 		resp.Diagnostics.AddError("Client Error", fmt.Sprintf("Unable to get node, got error: %s", err))
 		return
 	}
 
 	if node.Status == "terminated" {
-		tflog.Error(ctx, "Node has been terminated")
+		resp.Diagnostics.AddError("Unable To Import Node", fmt.Sprintf("Node %d has been terminated.", nodeId))
 		return
 	}
-	imageSlice := strings.Split(node.Image, ":")
-	diags := resp.State.Set(ctx, &onFinalityNode{
-		WorkspaceId:    types.Int64{Value: int64(node.WorkspaceID)},
-		NetworkSpecKey: types.String{Value: node.NetworkSpecKey},
-		NodeSpec: nodeSpec{
-			Key:        types.String{Value: node.NodeSpec},
-			Multiplier: types.Int64{Value: int64(node.NodeSpecMultiplier)},
-		},
-		NodeType:     types.String{Value: node.NodeType},
-		NodeName:     types.String{Value: node.Name},
-		ClusterHash:  types.String{Value: node.ClusterHash},
-		Storage:      types.String{Value: node.Storage},
-		ImageVersion: types.String{Value: imageSlice[len(imageSlice)-1]},
-		Image:        types.String{Value: node.Image},
-		Id:           types.Int64{Value: int64(node.ID)},
-	})
+	// the same mapping as Read, with the attributes only the configuration
+	// sets left null and no timeouts block
+	data := onFinalityNode{
+		Storage:                Quantity{Null: true},
+		PreventReplace:         types.Bool{Null: true},
+		ReplaceOnStorageShrink: types.Bool{Null: true},
+		Timeouts:               nodeTimeoutsBlock{},
+	}
+	applyNodeDetail(&data, node, r.nodeCluster(ctx, node.ClusterHash))
+
+	diags := resp.State.Set(ctx, &data)
 	resp.Diagnostics.Append(diags...)
 }
+
+// parseNodeImportId splits an import id into the workspace id and either the
+// node id or the node name.
+func parseNodeImportId(id string) (wsId uint64, nodeId uint64, name string, err error) {
+	parts := strings.SplitN(id, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, "", fmt.Errorf("%q has no workspace id", id)
+	}
+	wsId, err = strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || wsId == 0 {
+		return 0, 0, "", fmt.Errorf("%q is not a workspace id", parts[0])
+	}
+	if strings.HasPrefix(parts[1], "name=") {
+		name = strings.TrimPrefix(parts[1], "name=")
+		if name == "" {
+			return 0, 0, "", fmt.Errorf("%q has an empty node name", id)
+		}
+		return wsId, 0, name, nil
+	}
+	nodeId, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil || nodeId == 0 {
+		return 0, 0, "", fmt.Errorf("%q is not a node id", parts[1])
+	}
+	return wsId, nodeId, "", nil
+}
+
+// findNodeByName returns the id of the only node in the workspace named name,
+// ignoring terminated nodes. Otherwise it adds an error to diags and returns
+// false.
+func (r nodeResource) findNodeByName(ctx context.Context, wsId uint64, name string, diags *diag.Diagnostics) (uint64, bool) {
+	nodes, err := r.provider.client.GetNodeList(ctx, wsId)
+	if err != nil {
+		diags.AddError("Client Error", fmt.Sprintf("Unable to list nodes, got error: %s", err))
+		return 0, false
+	}
+	var ids []string
+	var nodeId uint64
+	for _, node := range nodes {
+		if node.Name == name && node.Status != "terminated" {
+			nodeId = node.ID
+			ids = append(ids, strconv.FormatUint(node.ID, 10))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		diags.AddError("Node Not Found", fmt.Sprintf("No node named %q in workspace %d.", name, wsId))
+		return 0, false
+	case 1:
+		return nodeId, true
+	default:
+		diags.AddError(
+			"Ambiguous Node Name",
+			fmt.Sprintf("%d nodes are named %q in workspace %d, import one by id instead: %s.", len(ids), name, wsId, strings.Join(ids, ", ")),
+		)
+		return 0, false
+	}
+}
@@ -1,79 +1,960 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	frameworkResource "github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 )
 
 func TestAccExampleResource(t *testing.T) {
+	fake := newFakeApi(t)
 	resource.Test(t, resource.TestCase{
 		PreCheck:                 func() { testAccPreCheck(t) },
 		ProtoV6ProviderFactories: testAccProtoV6ProviderFactories,
 		Steps: []resource.TestStep{
 			// Create and Read testing
 			{
-				Config: testAccExampleResourceConfig(),
+				Config: testAccExampleResourceConfig(fake, "ian test"),
 				Check: resource.ComposeAggregateTestCheckFunc(
-					resource.TestCheckResourceAttr("onfinality_node.test", "workspace_id", "6635707676612587520"),
+					resource.TestCheckResourceAttr("onfinality_node.test", "workspace_id", "10"),
+					resource.TestCheckResourceAttr("onfinality_node.test", "status", "running"),
+					resource.TestCheckResourceAttr("onfinality_node.test", "stopped", "false"),
 				),
 			},
 			// ImportState testing
-			{
-				ResourceName:      "onfinality_node.test",
-				ImportState:       true,
-				ImportStateVerify: true,
-				// This is not normally necessary, but is here because this
-				// example code does not have an actual upstream service.
-				// Once the Read method is able to refresh information from
-				// the upstream service, this can be removed.
-				ImportStateVerifyIgnore: []string{},
-			},
+			testAccNodeImportStep("onfinality_node.test"),
 			// Update and Read testing
 			{
-				Config: testAccExampleResourceConfig2(),
+				Config: testAccExampleResourceConfig(fake, "ian test2"),
 				Check: resource.ComposeAggregateTestCheckFunc(
 					resource.TestCheckResourceAttr("onfinality_node.test", "node_name", "ian test2"),
 				),
 			},
+			// Stopped, archive and validator nodes
+			{
+				Config: testAccExampleResourceConfig(fake, "ian test2", testAccStoppedNode, testAccArchiveNode, testAccValidatorNode),
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("onfinality_node.stopped", "stopped", "true"),
+					resource.TestCheckResourceAttr("onfinality_node.stopped", "status", "stopped"),
+					resource.TestCheckResourceAttr("onfinality_node.archive", "node_type", "archive"),
+					resource.TestCheckResourceAttr("onfinality_node.archive", "storage", "1Ti"),
+					resource.TestCheckResourceAttr("onfinality_node.validator", "node_type", "validator"),
+					resource.TestCheckResourceAttr("onfinality_node.validator", "public_port", "false"),
+					resource.TestCheckNoResourceAttr("onfinality_node.validator", "api_key"),
+				),
+			},
+			testAccNodeImportStep("onfinality_node.stopped"),
+			testAccNodeImportStep("onfinality_node.archive"),
+			testAccNodeImportStep("onfinality_node.validator"),
 			// Delete testing automatically occurs in TestCase
 		},
 	})
 }
 
-func testAccExampleResourceConfig() string {
+// testAccNodeImportStep imports the node of resourceName by its
+// "<workspace_id>:<id>" import id and verifies it against the created one.
+func testAccNodeImportStep(resourceName string) resource.TestStep {
+	return resource.TestStep{
+		ResourceName:      resourceName,
+		ImportState:       true,
+		ImportStateVerify: true,
+		ImportStateIdFunc: func(s *terraform.State) (string, error) {
+			rs, ok := s.RootModule().Resources[resourceName]
+			if !ok {
+				return "", fmt.Errorf("resource %s not found in state", resourceName)
+			}
+			return fmt.Sprintf("%s:%s", rs.Primary.Attributes["workspace_id"], rs.Primary.ID), nil
+		},
+	}
+}
+
+// testAccExampleResourceConfig configures the provider against fake, with the
+// node "test" named nodeName and the other nodes given.
+func testAccExampleResourceConfig(fake *fakeApi, nodeName string, nodes ...string) string {
 	return fmt.Sprintf(`
+provider "onfinality" {
+  access_key                  = "access"
+  secret_key                  = "secret"
+  api_url                     = %q
+  workspace_id                = 10
+  skip_credentials_validation = true
+}
+
 resource "onfinality_node" "test" {
-  workspace_id         = 6635707676612587520
+  workspace_id         = 10
   network_spec_key     = "polkadot"
   node_spec = {
     key = "unit"
     multiplier = 4
   }
   node_type            = "full"
-  node_name            = "ian test"
+  node_name            = %q
   cluster_hash         = "jm"
   storage              = "150Gi"
   image_version        = "v0.9.27"
 }
-`)
+%s`, fake.apiUrl(), nodeName, strings.Join(nodes, ""))
 }
 
-func testAccExampleResourceConfig2() string {
-	return fmt.Sprintf(`
-resource "onfinality_node" "test" {
-  workspace_id         = 6635707676612587520
+const testAccStoppedNode = `
+resource "onfinality_node" "stopped" {
   network_spec_key     = "polkadot"
   node_spec = {
     key = "unit"
     multiplier = 4
   }
   node_type            = "full"
-  node_name            = "ian test2"
+  node_name            = "stopped"
   cluster_hash         = "jm"
   storage              = "150Gi"
   image_version        = "v0.9.27"
+  stopped              = true
+}
+`
+
+const testAccArchiveNode = `
+resource "onfinality_node" "archive" {
+  network_spec_key     = "kusama"
+  node_spec = {
+    key = "unit"
+    multiplier = 4
+  }
+  node_type            = "archive"
+  node_name            = "archive"
+  cluster_hash         = "lz"
+  storage              = "1Ti"
+  image_version        = "v0.9.28"
+}
+`
+
+const testAccValidatorNode = `
+resource "onfinality_node" "validator" {
+  network_spec_key     = "polkadot"
+  node_spec = {
+    key = "unit"
+    multiplier = 8
+  }
+  node_type            = "validator"
+  node_name            = "validator"
+  cluster_hash         = "jm"
+  storage              = "200Gi"
+  image_version        = "v0.9.27"
+  use_api_key          = false
+  public_port          = false
+}
+`
+
+func TestNodeModifyPlanDefaultWorkspace(t *testing.T) {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	config := onFinalityNode{
+		WorkspaceId: types.Int64{Null: true},
+		Id:          types.Int64{Unknown: true},
+		Storage:     Quantity{Null: true},
+		Image:       types.String{Unknown: true},
+		Stopped:     types.Bool{Unknown: true},
+	}
+	modifyPlan := func(r nodeResource) frameworkResource.ModifyPlanResponse {
+		raw := testObject(t, schema, &config)
+		resp := frameworkResource.ModifyPlanResponse{Plan: tfsdk.Plan{Schema: schema, Raw: raw}}
+		r.ModifyPlan(ctx, frameworkResource.ModifyPlanRequest{
+			Config: tfsdk.Config{Schema: schema, Raw: raw},
+			Plan:   tfsdk.Plan{Schema: schema, Raw: raw},
+			State:  tfsdk.State{Schema: schema, Raw: tftypes.NewValue(schema.TerraformType(ctx), nil)},
+		}, &resp)
+		return resp
+	}
+
+	resp := modifyPlan(nodeResource{provider: onfinalityProvider{workspaceId: 42}})
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var plan onFinalityNode
+	resp.Plan.Get(ctx, &plan)
+	if plan.WorkspaceId.Value != 42 {
+		t.Errorf("expected workspace_id 42 from the provider, got %v", plan.WorkspaceId)
+	}
+
+	resp = modifyPlan(nodeResource{})
+	if !resp.Diagnostics.HasError() {
+		t.Error("expected an error without any workspace_id")
+	}
+
+	config.WorkspaceId = types.Int64{Value: 7}
+	resp = modifyPlan(nodeResource{provider: onfinalityProvider{workspaceId: 42}})
+	resp.Plan.Get(ctx, &plan)
+	if plan.WorkspaceId.Value != 7 {
+		t.Errorf("expected the configured workspace_id 7, got %v", plan.WorkspaceId)
+	}
+}
+
+func TestNodeImmutableAttributes(t *testing.T) {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	state := testNodePlan()
+	state.Id = types.Int64{Value: 1}
+	state.Image = types.String{Value: "onfinality/polkadot:v0.9.27"}
+	state.Stopped = types.Bool{Value: false}
+	state.PreventReplace = types.Bool{Null: true}
+
+	modify := func(config onFinalityNode) tfsdk.ModifyAttributePlanResponse {
+		raw := testObject(t, schema, &config)
+		resp := tfsdk.ModifyAttributePlanResponse{AttributePlan: config.ClusterHash}
+		ReplaceUnlessPreventedModifier().Modify(ctx, tfsdk.ModifyAttributePlanRequest{
+			AttributePath:   path.Root("cluster_hash"),
+			AttributeConfig: config.ClusterHash,
+			AttributePlan:   config.ClusterHash,
+			AttributeState:  state.ClusterHash,
+			Config:          tfsdk.Config{Schema: schema, Raw: raw},
+			Plan:            tfsdk.Plan{Schema: schema, Raw: raw},
+			State:           tfsdk.State{Schema: schema, Raw: testObject(t, schema, &state)},
+		}, &resp)
+		return resp
+	}
+
+	if resp := modify(state); resp.RequiresReplace || resp.Diagnostics.HasError() {
+		t.Errorf("expected no replace without a change, got %v", resp.Diagnostics)
+	}
+	moved := state
+	moved.ClusterHash = types.String{Value: "lz"}
+	if resp := modify(moved); !resp.RequiresReplace || resp.Diagnostics.HasError() {
+		t.Errorf("expected a new cluster_hash to replace the node, got %v", resp.Diagnostics)
+	}
+	moved.PreventReplace = types.Bool{Value: true}
+	if resp := modify(moved); resp.RequiresReplace || !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Replacement Prevented" {
+		t.Errorf("expected prevent_replace to fail the plan, got %v", resp.Diagnostics)
+	}
+
+	// a new provider default workspace replaces nodes without workspace_id
+	config := state
+	config.WorkspaceId = types.Int64{Null: true}
+	modifyPlan := func(config onFinalityNode) frameworkResource.ModifyPlanResponse {
+		raw := testObject(t, schema, &config)
+		resp := frameworkResource.ModifyPlanResponse{Plan: tfsdk.Plan{Schema: schema, Raw: raw}}
+		nodeResource{provider: onfinalityProvider{workspaceId: 20}}.ModifyPlan(ctx, frameworkResource.ModifyPlanRequest{
+			Config: tfsdk.Config{Schema: schema, Raw: raw},
+			Plan:   tfsdk.Plan{Schema: schema, Raw: raw},
+			State:  tfsdk.State{Schema: schema, Raw: testObject(t, schema, &state)},
+		}, &resp)
+		return resp
+	}
+	if resp := modifyPlan(config); len(resp.RequiresReplace) != 1 || !resp.RequiresReplace[0].Equal(path.Root("workspace_id")) {
+		t.Errorf("expected a new default workspace to replace the node, got %v %v", resp.RequiresReplace, resp.Diagnostics)
+	}
+	config.PreventReplace = types.Bool{Value: true}
+	if resp := modifyPlan(config); len(resp.RequiresReplace) != 0 || !resp.Diagnostics.HasError() {
+		t.Errorf("expected prevent_replace to fail the plan, got %v %v", resp.RequiresReplace, resp.Diagnostics)
+	}
+}
+
+func TestNodeModifyPlanStorage(t *testing.T) {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	state := testNodePlan()
+	state.Id = types.Int64{Value: 1}
+	state.Image = types.String{Value: "onfinality/polkadot:v0.9.27"}
+	state.Stopped = types.Bool{Value: false}
+
+	modifyPlan := func(storage string, replaceOnShrink bool) frameworkResource.ModifyPlanResponse {
+		config := state
+		config.Storage = Quantity{Value: storage}
+		config.ReplaceOnStorageShrink = types.Bool{Value: replaceOnShrink}
+		raw := testObject(t, schema, &config)
+		resp := frameworkResource.ModifyPlanResponse{Plan: tfsdk.Plan{Schema: schema, Raw: raw}}
+		nodeResource{}.ModifyPlan(ctx, frameworkResource.ModifyPlanRequest{
+			Config: tfsdk.Config{Schema: schema, Raw: raw},
+			Plan:   tfsdk.Plan{Schema: schema, Raw: raw},
+			State:  tfsdk.State{Schema: schema, Raw: testObject(t, schema, &state)},
+		}, &resp)
+		return resp
+	}
+
+	if resp := modifyPlan("200Gi", false); resp.Diagnostics.HasError() || len(resp.RequiresReplace) != 0 {
+		t.Errorf("expected growing the storage to update in place, got %v %v", resp.RequiresReplace, resp.Diagnostics)
+	}
+	if resp := modifyPlan("50Gi", false); !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Unable To Shrink Storage" {
+		t.Errorf("expected shrinking the storage to fail the plan, got %v", resp.Diagnostics)
+	}
+	if resp := modifyPlan("50Gi", true); resp.Diagnostics.HasError() || len(resp.RequiresReplace) != 1 || !resp.RequiresReplace[0].Equal(path.Root("storage")) {
+		t.Errorf("expected shrinking the storage to replace the node, got %v %v", resp.RequiresReplace, resp.Diagnostics)
+	}
+	if resp := modifyPlan("102400Mi", false); resp.Diagnostics.HasError() || len(resp.RequiresReplace) != 0 {
+		t.Errorf("expected the same size in another unit to be no change, got %v %v", resp.RequiresReplace, resp.Diagnostics)
+	}
+
+	// other attributes may be unknown, e.g. set from another resource
+	config := state
+	config.Storage = Quantity{Value: "50Gi"}
+	plan := tfsdk.Plan{Schema: schema, Raw: testObject(t, schema, &config)}
+	plan.SetAttribute(ctx, path.Root("node_spec"), types.Object{
+		Unknown:   true,
+		AttrTypes: map[string]attr.Type{"key": types.StringType, "multiplier": types.Int64Type},
+	})
+	plan.SetAttribute(ctx, path.Root("timeouts"), types.List{
+		Unknown:  true,
+		ElemType: types.ObjectType{AttrTypes: map[string]attr.Type{"create": types.StringType, "update": types.StringType, "delete": types.StringType}},
+	})
+	resp := frameworkResource.ModifyPlanResponse{Plan: plan}
+	nodeResource{}.ModifyPlan(ctx, frameworkResource.ModifyPlanRequest{
+		Config: tfsdk.Config{Schema: schema, Raw: plan.Raw},
+		Plan:   plan,
+		State:  tfsdk.State{Schema: schema, Raw: testObject(t, schema, &state)},
+	}, &resp)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Unable To Shrink Storage" {
+		t.Errorf("expected shrinking the storage to fail the plan with unknown attributes, got %v", resp.Diagnostics)
+	}
+}
+
+func TestNodeCreateOptions(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	plan := testNodePlan()
+	plan.InitFromBackup = types.Bool{Value: false}
+	plan.PublicPort = types.Bool{Value: false}
+	created := createTestNode(t, r, plan)
+	if created.Diagnostics.HasError() {
+		t.Fatal(created.Diagnostics)
+	}
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+	node := fake.node(uint64(state.Id.Value))
+	if *node.InitFromBackup || !*node.UseApiKey || *node.PublicPort {
+		t.Errorf("expected the create options to be sent, got %v %v %v", *node.InitFromBackup, *node.UseApiKey, *node.PublicPort)
+	}
+
+	// read back what the API reports, or keep the prior value if it doesn't
+	publicPort := true
+	fake.updateNode(uint64(state.Id.Value), func(node *nodeDetail) {
+		node.UseApiKey = nil
+		node.PublicPort = &publicPort
+	})
+	var read onFinalityNode
+	readNodeResponse(t, r, state).State.Get(ctx, &read)
+	if read.InitFromBackup.Value || !read.UseApiKey.Value || !read.PublicPort.Value {
+		t.Errorf("unexpected create options after read %+v", read)
+	}
+}
+
+func TestNodeEndpoints(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+	if state.RpcEndpoint.Value != "https://polkadot.api.onfinality.io/rpc" || state.WsEndpoint.Value != "wss://polkadot.api.onfinality.io/ws" ||
+		state.P2pEndpoint.IsNull() || state.ApiKey.Value != fmt.Sprintf("key-%d", state.Id.Value) {
+		t.Errorf("expected the endpoints in state after create, got %+v", state)
+	}
+
+	plan := testNodePlan()
+	plan.UseApiKey = types.Bool{Value: false}
+	created = createTestNode(t, r, plan)
+	created.State.Get(ctx, &state)
+	if !state.ApiKey.IsNull() {
+		t.Errorf("expected no api_key without use_api_key, got %v", state.ApiKey)
+	}
+
+	fake.updateNode(uint64(state.Id.Value), func(node *nodeDetail) { node.Endpoints.WS = "wss://polkadot-2.api.onfinality.io/ws" })
+	var read onFinalityNode
+	readNodeResponse(t, r, state).State.Get(ctx, &read)
+	if read.WsEndpoint.Value != "wss://polkadot-2.api.onfinality.io/ws" {
+		t.Errorf("expected the endpoints to be refreshed, got %v", read.WsEndpoint)
+	}
+}
+
+func TestSplitEndpointApiKey(t *testing.T) {
+	cases := []struct {
+		endpoint string
+		stripped string
+		key      string
+	}{
+		{"https://polkadot.api.onfinality.io/rpc?apikey=abc", "https://polkadot.api.onfinality.io/rpc", "abc"},
+		{"wss://polkadot.api.onfinality.io/ws?apikey=abc&x=1", "wss://polkadot.api.onfinality.io/ws?x=1", "abc"},
+		{"https://polkadot.api.onfinality.io/rpc", "https://polkadot.api.onfinality.io/rpc", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		stripped, key := splitEndpointApiKey(c.endpoint)
+		if stripped != c.stripped || key != c.key {
+			t.Errorf("unexpected result for %q: %q %q", c.endpoint, stripped, key)
+		}
+	}
+}
+
+func TestNodeComputedAttributes(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+	if state.Status.Value != "running" || state.CreatedAt.Value != "2022-09-01T10:00:00Z" || state.Owner.Value != 1 ||
+		state.Region.Value != "asia-northeast1" || state.Cloud.Value != "gcp" || state.Cpu.Value != "2000m" || state.Memory.Value != "6144Mi" {
+		t.Errorf("unexpected computed attributes after create %+v", state)
+	}
+
+	// stuck outside running
+	fake.updateNode(uint64(state.Id.Value), func(node *nodeDetail) {
+		node.Status = "syncing"
+		node.UpdatedAt = "2022-09-02T10:00:00Z"
+	})
+	var read onFinalityNode
+	readNodeResponse(t, r, state).State.Get(ctx, &read)
+	if read.Status.Value != "syncing" || read.UpdatedAt.Value != "2022-09-02T10:00:00Z" {
+		t.Errorf("expected status and updated_at to be refreshed, got %v %v", read.Status, read.UpdatedAt)
+	}
+}
+
+func TestBoolDefaultModifier(t *testing.T) {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	state := testNodePlan()
+	state.Id = types.Int64{Value: 1}
+	state.Image = types.String{Value: "onfinality/polkadot:v0.9.27"}
+	state.Stopped = types.Bool{Value: false}
+	state.PublicPort = types.Bool{Value: false}
+	config := state
+	config.PublicPort = types.Bool{Null: true}
+	raw := testObject(t, schema, &config)
+	req := tfsdk.ModifyAttributePlanRequest{
+		AttributePath:   path.Root("public_port"),
+		AttributeConfig: config.PublicPort,
+		AttributePlan:   types.Bool{Unknown: true},
+		AttributeState:  state.PublicPort,
+		Config:          tfsdk.Config{Schema: schema, Raw: raw},
+		Plan:            tfsdk.Plan{Schema: schema, Raw: raw},
+		State:           tfsdk.State{Schema: schema, Raw: testObject(t, schema, &state)},
+	}
+
+	// modifiers run in schema order, each on the previous plan
+	resp := tfsdk.ModifyAttributePlanResponse{AttributePlan: req.AttributePlan}
+	BoolDefaultModifier(true).Modify(ctx, req, &resp)
+	if !resp.AttributePlan.Equal(types.Bool{Value: true}) {
+		t.Fatalf("expected the default true to be planned, got %v", resp.AttributePlan)
+	}
+	req.AttributePlan = resp.AttributePlan
+	ReplaceUnlessPreventedModifier().Modify(ctx, req, &resp)
+	if !resp.RequiresReplace {
+		t.Error("expected going back to the default to replace the node")
+	}
+}
+
+func TestNodeTimeouts(t *testing.T) {
+	var unset nodeTimeoutsBlock
+	if unset.create() != defaultCreateTimeout || unset.update() != defaultUpdateTimeout || unset.delete() != defaultDeleteTimeout {
+		t.Error("expected the defaults without a timeouts block")
+	}
+
+	timeouts := nodeTimeoutsBlock{{
+		Create: types.String{Value: "1h"},
+		Update: types.String{Null: true},
+		Delete: types.String{Value: "90s"},
+	}}
+	if timeouts.create() != time.Hour || timeouts.update() != defaultUpdateTimeout || timeouts.delete() != 90*time.Second {
+		t.Errorf("unexpected timeouts %s %s %s", timeouts.create(), timeouts.update(), timeouts.delete())
+	}
+}
+
+func TestDurationValidator(t *testing.T) {
+	cases := map[string]bool{"30s": true, "1h30m": true, "10": false, "-5m": false, "0s": false, "soon": false}
+	for value, valid := range cases {
+		resp := tfsdk.ValidateAttributeResponse{}
+		DurationValidator().Validate(context.Background(), tfsdk.ValidateAttributeRequest{AttributeConfig: types.String{Value: value}}, &resp)
+		if resp.Diagnostics.HasError() == valid {
+			t.Errorf("unexpected validation result for %q: %v", value, resp.Diagnostics)
+		}
+	}
+}
+
+func TestNodeCreateWaitsForRunning(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	resp := createTestNode(t, r, testNodePlan())
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var node onFinalityNode
+	resp.State.Get(ctx, &node)
+	if node.Id.IsNull() || node.Image.Value != "onfinality/polkadot:v0.9.27" || node.Stopped.Value {
+		t.Errorf("unexpected state %+v", node)
+	}
+
+	plan := testNodePlan()
+	plan.Stopped = types.Bool{Value: true}
+	resp = createTestNode(t, r, plan)
+	resp.State.Get(ctx, &node)
+	if resp.Diagnostics.HasError() || !node.Stopped.Value || fake.node(uint64(node.Id.Value)).Status != "stopped" {
+		t.Errorf("expected the node to be stopped after create, got %+v %v", node, resp.Diagnostics)
+	}
+
+	fake.setCreateStatus("error")
+	resp = createTestNode(t, r, testNodePlan())
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Node Error" {
+		t.Errorf("expected the node in error to fail the create, got %v", resp.Diagnostics)
+	}
+	resp.State.Get(ctx, &node)
+	if node.Id.IsNull() {
+		t.Error("expected the failed node to be kept in state, so it's tainted")
+	}
+
+	fake.setCreateStatus("initializing")
+	plan = testNodePlan()
+	plan.Timeouts = nodeTimeoutsBlock{{Create: types.String{Value: "20ms"}, Update: types.String{Null: true}, Delete: types.String{Null: true}}}
+	resp = createTestNode(t, r, plan)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Timeout Waiting For Node" {
+		t.Errorf("expected the create to time out, got %v", resp.Diagnostics)
+	}
+}
+
+func TestNodeUpdateError(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+
+	plan := state
+	plan.NodeName = types.String{Value: "renamed"}
+	plan.Storage = Quantity{Value: "200Gi"}
+	fake.setActionStatus("update", "error")
+	fake.setStatusMessage(uint64(state.Id.Value), "insufficient capacity in cluster jm")
+
+	resp := updateTestNode(t, r, state, plan)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Node Error" {
+		t.Fatalf("expected the node in error to fail the update, got %v", resp.Diagnostics)
+	}
+	if detail := resp.Diagnostics.Errors()[0].Detail(); !strings.Contains(detail, "insufficient capacity in cluster jm") {
+		t.Errorf("expected the failure reason in the diagnostic, got %q", detail)
+	}
+	var node onFinalityNode
+	resp.State.Get(ctx, &node)
+	if node.NodeName.Value != "renamed" || node.Storage.Value != "100Gi" {
+		t.Errorf("expected state to reflect the node rather than the plan, got %+v", node)
+	}
+}
+
+func TestNodeUpdateWithoutStopped(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	var state onFinalityNode
+	createTestNode(t, r, testNodePlan()).State.Get(ctx, &state)
+	// stopped outside Terraform
+	fake.setNodeStatus(uint64(state.Id.Value), "stopped")
+	readNodeResponse(t, r, state).State.Get(ctx, &state)
+
+	// stopped isn't in the configuration, so it's planned unknown
+	plan := state
+	plan.NodeName = types.String{Value: "renamed"}
+	plan.Stopped = types.Bool{Unknown: true}
+	plan.Status = types.String{Unknown: true}
+	plan.UpdatedAt = types.String{Unknown: true}
+	resp := updateTestNode(t, r, state, plan)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var node onFinalityNode
+	resp.State.Get(ctx, &node)
+	if node.Stopped.IsUnknown() || !node.Stopped.Value || node.Status.Value != "stopped" || node.NodeName.Value != "renamed" {
+		t.Errorf("expected the node to stay stopped with known state, got %+v", node)
+	}
+	if status := fake.node(uint64(state.Id.Value)).Status; status != "stopped" {
+		t.Errorf("expected the node not to be resumed, got %s", status)
+	}
+}
+
+func TestNodeUpdateNotAppliedYet(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	var state onFinalityNode
+	createTestNode(t, r, testNodePlan()).State.Get(ctx, &state)
+
+	// the node reads running before the API applies the update
+	fake.setStaleUpdates(true)
+	plan := state
+	plan.NodeName = types.String{Value: "renamed"}
+	plan.ImageVersion = types.String{Value: "v0.9.28"}
+	plan.Image = types.String{Value: "onfinality/polkadot:v0.9.28"}
+	resp := updateTestNode(t, r, state, plan)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var node onFinalityNode
+	resp.State.Get(ctx, &node)
+	if node.NodeName.Value != "renamed" || node.ImageVersion.Value != "v0.9.28" || node.Image.Value != "onfinality/polkadot:v0.9.28" {
+		t.Errorf("expected the planned attributes in state, got %+v", node)
+	}
+
+	// the next Read reports the node as it is
+	var read onFinalityNode
+	readNodeResponse(t, r, node).State.Get(ctx, &read)
+	if read.NodeName.Value != "ian test" || read.ImageVersion.Value != "v0.9.27" {
+		t.Errorf("expected Read to report the drift, got %+v", read)
+	}
 }
-`)
+
+func TestNodeUpdateWaitsForSettledStatus(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	plan := testNodePlan()
+	plan.Stopped = types.Bool{Value: true}
+	var state onFinalityNode
+	createTestNode(t, r, plan).State.Get(ctx, &state)
+
+	// renaming a stopped node keeps it stopped
+	plan = state
+	plan.NodeName = types.String{Value: "renamed"}
+	resp := updateTestNode(t, r, state, plan)
+	if resp.Diagnostics.HasError() {
+		t.Fatalf("expected renaming a stopped node to succeed, got %v", resp.Diagnostics)
+	}
+	resp.State.Get(ctx, &state)
+
+	// an unrelated final status fails the wait straight away
+	fake.setActionStatus("resume", "terminated")
+	plan = state
+	plan.Stopped = types.Bool{Value: false}
+	resp = updateTestNode(t, r, state, plan)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Node Error" {
+		t.Errorf("expected a terminated node to fail the resume, got %v", resp.Diagnostics)
+	}
+}
+
+func TestNodeDelete(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+
+	resp := deleteTestNode(t, r, state)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	if status := fake.node(uint64(state.Id.Value)).Status; status != "terminated" {
+		t.Errorf("expected the node to be terminated, got %s", status)
+	}
+
+	// terminated and purged nodes are already gone
+	resp = deleteTestNode(t, r, state)
+	if resp.Diagnostics.HasError() {
+		t.Errorf("expected deleting a terminated node to succeed, got %v", resp.Diagnostics)
+	}
+	purged := state
+	purged.Id = types.Int64{Value: 999}
+	resp = deleteTestNode(t, r, purged)
+	if resp.Diagnostics.HasError() {
+		t.Errorf("expected deleting a missing node to succeed, got %v", resp.Diagnostics)
+	}
+
+	// nodes in error can still be terminated, and may report error while
+	// terminating
+	created = createTestNode(t, r, testNodePlan())
+	created.State.Get(ctx, &state)
+	fake.setNodeStatus(uint64(state.Id.Value), "error")
+	fake.setStatusPolls(uint64(state.Id.Value), "error", "error", "terminating")
+	resp = deleteTestNode(t, r, state)
+	if resp.Diagnostics.HasError() {
+		t.Errorf("expected deleting a node in error to succeed, got %v", resp.Diagnostics)
+	}
+	if status := fake.node(uint64(state.Id.Value)).Status; status != "terminated" {
+		t.Errorf("expected the node to be terminated, got %s", status)
+	}
+
+	created = createTestNode(t, r, testNodePlan())
+	created.State.Get(ctx, &state)
+	state.Timeouts = nodeTimeoutsBlock{{Create: types.String{Null: true}, Update: types.String{Null: true}, Delete: types.String{Value: "20ms"}}}
+	fake.setActionStatus("", "terminating")
+	resp = deleteTestNode(t, r, state)
+	if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != "Timeout Waiting For Node" {
+		t.Errorf("expected the delete to time out, got %v", resp.Diagnostics)
+	}
+
+	fake.setStatus(http.StatusInternalServerError)
+	resp = deleteTestNode(t, r, state)
+	if !resp.Diagnostics.HasError() {
+		t.Error("expected a failed terminate to be an error")
+	}
+}
+
+func TestNodeReadRemovesMissingNode(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+
+	purged := state
+	purged.Id = types.Int64{Value: 999}
+	resp := readNodeResponse(t, r, purged)
+	if resp.Diagnostics.HasError() || !resp.State.Raw.IsNull() {
+		t.Errorf("expected a missing node to be removed from state, got %v %v", resp.State.Raw, resp.Diagnostics)
+	}
+
+	fake.setNodeStatus(uint64(state.Id.Value), "terminated")
+	resp = readNodeResponse(t, r, state)
+	if resp.Diagnostics.HasError() || !resp.State.Raw.IsNull() {
+		t.Errorf("expected a terminated node to be removed from state, got %v %v", resp.State.Raw, resp.Diagnostics)
+	}
+
+	fake.setStatus(http.StatusInternalServerError)
+	resp = readNodeResponse(t, r, state)
+	if !resp.Diagnostics.HasError() || resp.State.Raw.IsNull() {
+		t.Errorf("expected other errors to fail the refresh and keep the state, got %v", resp.Diagnostics)
+	}
+}
+
+func TestNodeReadDetectsDrift(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	plan := testNodePlan()
+	plan.Stopped = types.Bool{Value: true}
+	created := createTestNode(t, r, plan)
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+
+	// changed in the OnFinality console
+	fake.updateNode(uint64(state.Id.Value), func(console *nodeDetail) {
+		console.Status = "running"
+		console.ClusterHash = "lz"
+		console.NetworkSpecKey = "kusama"
+	})
+
+	resp := readNodeResponse(t, r, state)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var node onFinalityNode
+	resp.State.Get(ctx, &node)
+	if node.Stopped.Value || node.ClusterHash.Value != "lz" || node.NetworkSpecKey.Value != "kusama" || node.WorkspaceId.Value != 10 {
+		t.Errorf("expected the console changes in state, got %+v", node)
+	}
+}
+
+func TestParseNodeImportId(t *testing.T) {
+	cases := []struct {
+		id     string
+		wsId   uint64
+		nodeId uint64
+		name   string
+	}{
+		{"10:1001", 10, 1001, ""},
+		{"10:name=ian test", 10, 0, "ian test"},
+		{"10:name=a:b", 10, 0, "a:b"},
+		{"1001", 0, 0, ""},
+		{"10:", 0, 0, ""},
+		{"ws:1001", 0, 0, ""},
+		{"10:node", 0, 0, ""},
+		{"10:name=", 0, 0, ""},
+	}
+	for _, c := range cases {
+		wsId, nodeId, name, err := parseNodeImportId(c.id)
+		if wsId != c.wsId || nodeId != c.nodeId || name != c.name || (err == nil) != (c.wsId != 0) {
+			t.Errorf("unexpected result for %q: %d %d %q %v", c.id, wsId, nodeId, name, err)
+		}
+	}
+}
+
+func TestNodeImportState(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+	var state onFinalityNode
+	createTestNode(t, r, testNodePlan()).State.Get(ctx, &state)
+
+	resp := importTestNode(t, r, fmt.Sprintf("10:%d", state.Id.Value))
+	var imported onFinalityNode
+	resp.State.Get(ctx, &imported)
+	if resp.Diagnostics.HasError() || imported.Id.Value != state.Id.Value {
+		t.Errorf("expected the node to be imported by id, got %v", resp.Diagnostics)
+	}
+
+	resp = importTestNode(t, r, "10:name=ian test")
+	resp.State.Get(ctx, &imported)
+	if resp.Diagnostics.HasError() || imported.Id.Value != state.Id.Value {
+		t.Errorf("expected the node to be imported by name, got %v", resp.Diagnostics)
+	}
+
+	expectImportError := func(id string, summary string) {
+		t.Helper()
+		resp := importTestNode(t, r, id)
+		if !resp.Diagnostics.HasError() || resp.Diagnostics.Errors()[0].Summary() != summary {
+			t.Errorf("expected %q importing %q, got %v", summary, id, resp.Diagnostics)
+		}
+	}
+	expectImportError(fmt.Sprintf("%d", state.Id.Value), "Invalid Import Id")
+	expectImportError("10:name=missing", "Node Not Found")
+
+	createTestNode(t, r, testNodePlan())
+	expectImportError("10:name=ian test", "Ambiguous Node Name")
+
+	fake.setNodeStatus(uint64(state.Id.Value), "terminated")
+	expectImportError(fmt.Sprintf("10:%d", state.Id.Value), "Unable To Import Node")
+}
+
+// TestNodeImportStateVerify imports nodes created by the resource and checks
+// the imported state matches the created one without Terraform, so it runs
+// without TF_ACC. TestAccExampleResource runs Terraform's import and verify.
+func TestNodeImportStateVerify(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	stopped := testNodePlan()
+	stopped.Stopped = types.Bool{Value: true}
+	archive := testNodePlan()
+	archive.NodeType = types.String{Value: "archive"}
+	archive.Storage = Quantity{Value: "1Ti"}
+	validator := testNodePlan()
+	validator.NodeType = types.String{Value: "validator"}
+	validator.NodeSpec.Multiplier = types.Int64{Value: 8}
+	validator.UseApiKey = types.Bool{Value: false}
+	validator.PublicPort = types.Bool{Value: false}
+
+	for name, plan := range map[string]onFinalityNode{"stopped": stopped, "archive": archive, "validator": validator} {
+		plan.PreventReplace = types.Bool{Null: true}
+		plan.ReplaceOnStorageShrink = types.Bool{Null: true}
+		created := createTestNode(t, r, plan)
+		if created.Diagnostics.HasError() {
+			t.Fatalf("%s: %v", name, created.Diagnostics)
+		}
+		var state onFinalityNode
+		created.State.Get(ctx, &state)
+
+		// terraform import reads the node straight after ImportState
+		imported := importTestNode(t, r, fmt.Sprintf("%d:%d", state.WorkspaceId.Value, state.Id.Value))
+		if imported.Diagnostics.HasError() {
+			t.Fatalf("%s: %v", name, imported.Diagnostics)
+		}
+		var importedState onFinalityNode
+		imported.State.Get(ctx, &importedState)
+		var read onFinalityNode
+		readResp := readNodeResponse(t, r, importedState)
+		if readResp.Diagnostics.HasError() {
+			t.Fatalf("%s: %v", name, readResp.Diagnostics)
+		}
+		readResp.State.Get(ctx, &read)
+
+		if !reflect.DeepEqual(read, state) {
+			t.Errorf("%s: imported state differs from the created one\nimported: %+v\ncreated:  %+v", name, read, state)
+		}
+	}
+}
+
+// testNodePlan is the planned value of a new polkadot node.
+func testNodePlan() onFinalityNode {
+	return onFinalityNode{
+		WorkspaceId:    types.Int64{Value: 10},
+		Id:             types.Int64{Unknown: true},
+		NetworkSpecKey: types.String{Value: "polkadot"},
+		NodeSpec:       nodeSpec{Key: types.String{Value: "unit"}, Multiplier: types.Int64{Value: 4}},
+		NodeType:       types.String{Value: "full"},
+		NodeName:       types.String{Value: "ian test"},
+		ClusterHash:    types.String{Value: "jm"},
+		Storage:        Quantity{Value: "100Gi"},
+		ImageVersion:   types.String{Value: "v0.9.27"},
+		Image:          types.String{Unknown: true},
+		Stopped:        types.Bool{Unknown: true},
+		InitFromBackup: types.Bool{Value: true},
+		UseApiKey:      types.Bool{Value: true},
+		PublicPort:     types.Bool{Value: true},
+		Timeouts:       nodeTimeoutsBlock{},
+	}
+}
+
+// newTestNodeResource returns the node resource of p, polling quickly.
+func newTestNodeResource(t *testing.T, p provider.Provider) nodeResource {
+	r, diags := onFinalityNode{}.NewResource(context.Background(), p)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	node := r.(nodeResource)
+	node.pollInterval = time.Millisecond
+	return node
+}
+
+func createTestNode(t *testing.T, r nodeResource, plan onFinalityNode) frameworkResource.CreateResponse {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	raw := testObject(t, schema, &plan)
+	resp := frameworkResource.CreateResponse{State: tfsdk.State{Schema: schema, Raw: tftypes.NewValue(schema.TerraformType(ctx), nil)}}
+	r.Create(ctx, frameworkResource.CreateRequest{
+		Config: tfsdk.Config{Schema: schema, Raw: raw},
+		Plan:   tfsdk.Plan{Schema: schema, Raw: raw},
+	}, &resp)
+	return resp
+}
+
+func updateTestNode(t *testing.T, r nodeResource, state onFinalityNode, plan onFinalityNode) frameworkResource.UpdateResponse {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	rawState := testObject(t, schema, &state)
+	rawPlan := testObject(t, schema, &plan)
+	resp := frameworkResource.UpdateResponse{State: tfsdk.State{Schema: schema, Raw: rawState}}
+	r.Update(ctx, frameworkResource.UpdateRequest{
+		Config: tfsdk.Config{Schema: schema, Raw: rawPlan},
+		Plan:   tfsdk.Plan{Schema: schema, Raw: rawPlan},
+		State:  tfsdk.State{Schema: schema, Raw: rawState},
+	}, &resp)
+	return resp
+}
+
+func deleteTestNode(t *testing.T, r nodeResource, state onFinalityNode) frameworkResource.DeleteResponse {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	raw := testObject(t, schema, &state)
+	resp := frameworkResource.DeleteResponse{State: tfsdk.State{Schema: schema, Raw: raw}}
+	r.Delete(ctx, frameworkResource.DeleteRequest{State: tfsdk.State{Schema: schema, Raw: raw}}, &resp)
+	return resp
+}
+
+func readNodeResponse(t *testing.T, r nodeResource, state onFinalityNode) frameworkResource.ReadResponse {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	raw := testObject(t, schema, &state)
+	resp := frameworkResource.ReadResponse{State: tfsdk.State{Schema: schema, Raw: raw}}
+	r.Read(ctx, frameworkResource.ReadRequest{State: tfsdk.State{Schema: schema, Raw: raw}}, &resp)
+	return resp
+}
+
+func importTestNode(t *testing.T, r nodeResource, id string) frameworkResource.ImportStateResponse {
+	ctx := context.Background()
+	schema, _ := onFinalityNode{}.GetSchema(ctx)
+	resp := frameworkResource.ImportStateResponse{State: tfsdk.State{Schema: schema, Raw: tftypes.NewValue(schema.TerraformType(ctx), nil)}}
+	r.ImportState(ctx, frameworkResource.ImportStateRequest{ID: id}, &resp)
+	return resp
 }
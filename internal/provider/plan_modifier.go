@@ -2,9 +2,12 @@ package provider
 
 import (
 	"context"
+	"fmt"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"strings"
 
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 )
 
@@ -83,3 +86,84 @@ func (r nodeImageModifier) Description(ctx context.Context) string {
 func (r nodeImageModifier) MarkdownDescription(ctx context.Context) string {
 	return "If the value of this attribute changes, Terraform will destroy and recreate the resource."
 }
+
+func ReplaceUnlessPreventedModifier() tfsdk.AttributePlanModifier {
+	return replaceUnlessPreventedModifier{}
+}
+
+// replaceUnlessPreventedModifier is an AttributePlanModifier for attributes
+// the API can't update. Changing them replaces the node, unless the resource
+// sets prevent_replace, in which case the plan fails.
+type replaceUnlessPreventedModifier struct{}
+
+// Modify fills the AttributePlanModifier interface. Like RequiresReplace it
+// skips creates, deletes and computed attributes without config, whose plan
+// is filled in by the resource's ModifyPlan. Attributes given a default by an
+// earlier modifier are compared as planned.
+func (r replaceUnlessPreventedModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
+	if req.AttributeConfig == nil || req.AttributePlan == nil || req.AttributeState == nil {
+		// shouldn't happen, but let's not panic if it does
+		return
+	}
+	if req.State.Raw.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+	if req.AttributeConfig.IsNull() && req.AttributePlan.IsUnknown() || req.AttributePlan.Equal(req.AttributeState) {
+		return
+	}
+	resp.RequiresReplace = requireReplace(ctx, req.Config, req.AttributePath, &resp.Diagnostics)
+}
+
+// requireReplace reports whether a change to attrPath should replace the
+// node. If the config sets prevent_replace it adds an error to diags instead.
+func requireReplace(ctx context.Context, config tfsdk.Config, attrPath path.Path, diags *diag.Diagnostics) bool {
+	var preventReplace types.Bool
+	diags.Append(config.GetAttribute(ctx, path.Root("prevent_replace"), &preventReplace)...)
+	if !preventReplace.Value {
+		return true
+	}
+	diags.AddAttributeError(
+		attrPath,
+		"Replacement Prevented",
+		fmt.Sprintf("Changing %s requires the node to be destroyed and created again, which prevent_replace forbids. Revert the change, or unset prevent_replace to replace the node.", attrPath),
+	)
+	return false
+}
+
+// Description returns a human-readable description of the plan modifier.
+func (r replaceUnlessPreventedModifier) Description(ctx context.Context) string {
+	return "If the value of this attribute changes, Terraform will destroy and recreate the resource, unless prevent_replace is set."
+}
+
+// MarkdownDescription returns a markdown description of the plan modifier.
+func (r replaceUnlessPreventedModifier) MarkdownDescription(ctx context.Context) string {
+	return "If the value of this attribute changes, Terraform will destroy and recreate the resource, unless `prevent_replace` is set."
+}
+
+func BoolDefaultModifier(def bool) tfsdk.AttributePlanModifier {
+	return boolDefaultModifier{def: def}
+}
+
+// boolDefaultModifier is an AttributePlanModifier that plans def for an
+// optional and computed bool attribute missing from the configuration.
+type boolDefaultModifier struct {
+	def bool
+}
+
+// Modify fills the AttributePlanModifier interface.
+func (m boolDefaultModifier) Modify(ctx context.Context, req tfsdk.ModifyAttributePlanRequest, resp *tfsdk.ModifyAttributePlanResponse) {
+	if req.AttributeConfig == nil || !req.AttributeConfig.IsNull() || req.Plan.Raw.IsNull() {
+		return
+	}
+	resp.AttributePlan = types.Bool{Value: m.def}
+}
+
+// Description returns a human-readable description of the plan modifier.
+func (m boolDefaultModifier) Description(ctx context.Context) string {
+	return fmt.Sprintf("Defaults to %t.", m.def)
+}
+
+// MarkdownDescription returns a markdown description of the plan modifier.
+func (m boolDefaultModifier) MarkdownDescription(ctx context.Context) string {
+	return fmt.Sprintf("Defaults to `%t`.", m.def)
+}
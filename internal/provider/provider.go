@@ -2,26 +2,47 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	onf "github.com/OnFinality-io/onf-cli/pkg/service"
 	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// defaultApiUrl is the OnFinality API used when neither the api_url attribute
+// nor the ONFINALITY_API_URL environment variable is set.
+const defaultApiUrl = "https://api.onfinality.io/api"
+
 // Ensure provider defined types fully satisfy framework interfaces
 var _ provider.Provider = &onfinalityProvider{}
 
 // provider satisfies the tfsdk.Provider interface and usually is included
 // with all Resource and DataSource implementations.
 type onfinalityProvider struct {
-	// client can contain the upstream provider SDK or HTTP client used to
-	// communicate with the upstream service. Resource and DataSource
-	// implementations can then make calls using this client.
-	//
-	// TODO: If appropriate, implement upstream provider SDK or HTTP client.
-	// client vendorsdk.ExampleClient
+	// client is the OnFinality API client built from this provider block's
+	// configuration in Configure. Resource and DataSource implementations
+	// make all their calls using this client.
+	client onfClient
+
+	// accessKey identifies the credentials the client signs requests with.
+	accessKey string
+
+	// clusters caches the clusters of GET /info for the provider instance.
+	// It's a pointer so copies of the provider share it.
+	clusters *clusterCache
+
+	// workspaceId is the workspace used by resources and data sources which
+	// omit their own workspace_id, zero when the provider doesn't set one.
+	workspaceId int64
 
 	// configured is set to true at the end of the Configure method.
 	// This can be used in Resource and DataSource implementations to verify
@@ -36,29 +57,323 @@ type onfinalityProvider struct {
 
 // providerData can be used to store data from the Terraform configuration.
 type providerData struct {
-	AccessKey types.String `tfsdk:"access_key"`
-	SecretKey types.String `tfsdk:"secret_key"`
+	AccessKey   types.String `tfsdk:"access_key"`
+	SecretKey   types.String `tfsdk:"secret_key"`
+	ApiUrl      types.String `tfsdk:"api_url"`
+	Profile     types.String `tfsdk:"profile"`
+	WorkspaceId types.Int64  `tfsdk:"workspace_id"`
+	MaxRetries  types.Int64  `tfsdk:"max_retries"`
+
+	UserAgentSuffix types.String `tfsdk:"user_agent_suffix"`
+
+	CaCertFile         types.String `tfsdk:"ca_cert_file"`
+	CaCertPem          types.String `tfsdk:"ca_cert_pem"`
+	InsecureSkipVerify types.Bool   `tfsdk:"insecure_skip_verify"`
+	ProxyUrl           types.String `tfsdk:"proxy_url"`
+	RequestTimeout     types.String `tfsdk:"request_timeout"`
+
+	SkipCredentialsValidation types.Bool `tfsdk:"skip_credentials_validation"`
 }
 
 func (p *onfinalityProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
 	var data providerData
 	diags := req.Config.Get(ctx, &data)
-	onf.Init(data.AccessKey.Value, data.SecretKey.Value, "https://api.onfinality.io/api")
 	resp.Diagnostics.Append(diags...)
 
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	// Configuration values are now available.
-	// if data.Example.Null { /* ... */ }
+	apiUrl := defaultApiUrl
+	if v := os.Getenv("ONFINALITY_API_URL"); v != "" {
+		apiUrl = v
+	}
+	if !data.ApiUrl.IsNull() && !data.ApiUrl.IsUnknown() && data.ApiUrl.Value != "" {
+		apiUrl = data.ApiUrl.Value
+	}
+	if err := validateApiUrl(apiUrl); err != nil {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("api_url"),
+			"Invalid API URL",
+			fmt.Sprintf("The OnFinality API URL %q is not valid: %s. Set api_url or ONFINALITY_API_URL to an absolute http(s) URL, e.g. %s", apiUrl, err, defaultApiUrl),
+		)
+		return
+	}
 
-	// If the upstream provider SDK or HTTP client requires configuration, such
-	// as authentication or logging, this is a great opportunity to do so.
+	accessKey, secretKey, profileWorkspaceId := resolveCredentials(data, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// the profile's default_workspace, overridden by env and then the
+	// workspace_id attribute
+	p.workspaceId = int64(profileWorkspaceId)
+
+	if v := os.Getenv("ONFINALITY_WORKSPACE_ID"); v != "" {
+		wsId, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("workspace_id"),
+				"Invalid Workspace Id",
+				fmt.Sprintf("Unable to parse env ONFINALITY_WORKSPACE_ID %q as a workspace id, got error: %s", v, err),
+			)
+			return
+		}
+		p.workspaceId = wsId
+	}
+	if !data.WorkspaceId.IsNull() && !data.WorkspaceId.IsUnknown() {
+		p.workspaceId = data.WorkspaceId.Value
+	}
+
+	httpClient := buildHttpClient(data, accessKey, secretKey, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	userAgentSuffix := os.Getenv("ONFINALITY_USER_AGENT_SUFFIX")
+	if !data.UserAgentSuffix.IsNull() && !data.UserAgentSuffix.IsUnknown() {
+		userAgentSuffix = data.UserAgentSuffix.Value
+	}
+	ua := userAgent(p.version, req.TerraformVersion, userAgentSuffix)
+
+	p.client = newApiClient(accessKey, secretKey, strings.TrimSuffix(apiUrl, "/"), p.version, ua, httpClient)
+	p.accessKey = accessKey
+	p.clusters = &clusterCache{}
+
+	if !data.SkipCredentialsValidation.Value {
+		p.validateCredentials(ctx, apiUrl, &resp.Diagnostics)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
 
 	p.configured = true
 }
 
+// buildHttpClient returns the HTTP client every API call of this provider
+// instance goes through: TLS and proxy settings at the bottom, then logging,
+// then retries, with the request timeout bounding a whole call.
+func buildHttpClient(data providerData, accessKey string, secretKey string, diags *diag.Diagnostics) *http.Client {
+	maxRetries := int64(defaultMaxRetries)
+	if !data.MaxRetries.IsNull() && !data.MaxRetries.IsUnknown() {
+		maxRetries = data.MaxRetries.Value
+	}
+	if maxRetries < 0 {
+		diags.AddAttributeError(path.Root("max_retries"), "Invalid Max Retries", "max_retries must not be negative.")
+		return nil
+	}
+
+	timeout := defaultRequestTimeout
+	if !data.RequestTimeout.IsNull() && !data.RequestTimeout.IsUnknown() {
+		var err error
+		timeout, err = time.ParseDuration(data.RequestTimeout.Value)
+		if err != nil || timeout <= 0 {
+			diags.AddAttributeError(path.Root("request_timeout"), "Invalid Request Timeout", fmt.Sprintf("request_timeout %q must be a positive duration such as \"30s\" or \"2m\".", data.RequestTimeout.Value))
+			return nil
+		}
+	}
+
+	opts := transportOptions{InsecureSkipVerify: data.InsecureSkipVerify.Value}
+	if !data.CaCertFile.IsNull() && !data.CaCertFile.IsUnknown() && data.CaCertFile.Value != "" {
+		pem, err := os.ReadFile(data.CaCertFile.Value)
+		if err != nil {
+			diags.AddAttributeError(path.Root("ca_cert_file"), "Unable to Read CA Certificate", fmt.Sprintf("Unable to read %s, got error: %s", data.CaCertFile.Value, err))
+			return nil
+		}
+		opts.CaCerts = append(opts.CaCerts, pem)
+	}
+	if !data.CaCertPem.IsNull() && !data.CaCertPem.IsUnknown() && data.CaCertPem.Value != "" {
+		opts.CaCerts = append(opts.CaCerts, []byte(data.CaCertPem.Value))
+	}
+	if !data.ProxyUrl.IsNull() && !data.ProxyUrl.IsUnknown() && data.ProxyUrl.Value != "" {
+		proxyUrl, err := url.Parse(data.ProxyUrl.Value)
+		if err != nil || proxyUrl.Scheme == "" || proxyUrl.Host == "" {
+			diags.AddAttributeError(path.Root("proxy_url"), "Invalid Proxy URL", fmt.Sprintf("proxy_url %q must be an absolute URL such as http://proxy.internal:3128.", data.ProxyUrl.Value))
+			return nil
+		}
+		opts.ProxyUrl = proxyUrl
+	}
+
+	transport, err := newBaseTransport(opts)
+	if err != nil {
+		diags.AddError("Invalid CA Certificate", fmt.Sprintf("Unable to load the CA certificates from ca_cert_file and ca_cert_pem: %s", err))
+		return nil
+	}
+	if opts.InsecureSkipVerify {
+		diags.AddAttributeWarning(
+			path.Root("insecure_skip_verify"),
+			"TLS Certificate Verification Disabled",
+			"insecure_skip_verify is set, so the OnFinality API's certificate is not verified and your access key, secret key and node API keys can be intercepted. Only use it for local testing, use ca_cert_file or ca_cert_pem to trust a private CA instead.",
+		)
+	}
+
+	return &http.Client{
+		Transport: newRetryTransport(newLoggingTransport(transport, accessKey, secretKey), int(maxRetries)),
+		Timeout:   timeout,
+	}
+}
+
+// validateCredentials makes a lightweight authenticated call so bad
+// credentials or an unreachable endpoint are reported once, precisely, instead
+// of as a client error on the first resource.
+func (p *onfinalityProvider) validateCredentials(ctx context.Context, apiUrl string, diags *diag.Diagnostics) {
+	workspaces, err := p.client.GetWorkspaceList(ctx)
+	if err != nil {
+		apiErr, ok := err.(*apiError)
+		var netErr net.Error
+		var urlErr *url.Error
+		switch {
+		case errors.As(err, &netErr) || errors.As(err, &urlErr):
+			diags.AddAttributeError(path.Root("api_url"), "Unable to Reach OnFinality API", fmt.Sprintf("Unable to connect to %s, got error: %s", apiUrl, err))
+		case !ok:
+			diags.AddError("Unable to Validate OnFinality Credentials", fmt.Sprintf("Unexpected response from %s: %s", apiUrl, err))
+		case apiErr.StatusCode == http.StatusUnauthorized:
+			diags.AddAttributeError(path.Root("access_key"), "Invalid OnFinality Credentials", fmt.Sprintf("The API rejected the access key, check access_key and secret_key: %s", apiErr.Message))
+		case apiErr.StatusCode == http.StatusForbidden:
+			diags.AddAttributeError(path.Root("access_key"), "Forbidden OnFinality Credentials", fmt.Sprintf("The access key is not allowed to list workspaces: %s", apiErr.Message))
+		default:
+			diags.AddError("Unable to Validate OnFinality Credentials", fmt.Sprintf("Unexpected response from %s: %s", apiUrl, apiErr))
+		}
+		return
+	}
+
+	if p.workspaceId == 0 {
+		return
+	}
+	for _, ws := range workspaces {
+		if int64(ws.ID) == p.workspaceId {
+			return
+		}
+	}
+	diags.AddAttributeWarning(
+		path.Root("workspace_id"),
+		"Workspace Not Accessible",
+		fmt.Sprintf("Workspace %d is not among the workspaces the access key can access, resources using it will fail.", p.workspaceId),
+	)
+}
+
+// resolveCredentials picks the access and secret key from, in order of
+// precedence, the provider configuration, env ONFINALITY_ACCESS_KEY and
+// ONFINALITY_SECRET_KEY, and finally the profile in the onf CLI credentials
+// file. Both keys come from the same source, a source setting only one of
+// them is an error. Keys from the profile come with its default_workspace,
+// zero when it has none.
+func resolveCredentials(data providerData, diags *diag.Diagnostics) (string, string, uint64) {
+	accessKey, secretKey := "", ""
+	if !data.AccessKey.IsNull() && !data.AccessKey.IsUnknown() {
+		accessKey = data.AccessKey.Value
+	}
+	if !data.SecretKey.IsNull() && !data.SecretKey.IsUnknown() {
+		secretKey = data.SecretKey.Value
+	}
+	if accessKey != "" && secretKey != "" {
+		return accessKey, secretKey, 0
+	}
+	if accessKey != "" || secretKey != "" {
+		missing, set := "secret_key", "access_key"
+		if accessKey == "" {
+			missing, set = set, missing
+		}
+		diags.AddAttributeError(
+			path.Root(missing),
+			"Incomplete OnFinality Credentials",
+			fmt.Sprintf("%s is set in the provider block without %s, set both.", set, missing),
+		)
+		return "", "", 0
+	}
+
+	accessKey = os.Getenv("ONFINALITY_ACCESS_KEY")
+	secretKey = os.Getenv("ONFINALITY_SECRET_KEY")
+	if accessKey != "" && secretKey != "" {
+		return accessKey, secretKey, 0
+	}
+	if accessKey != "" || secretKey != "" {
+		missing, set := "ONFINALITY_SECRET_KEY", "ONFINALITY_ACCESS_KEY"
+		if accessKey == "" {
+			missing, set = set, missing
+		}
+		diags.AddError(
+			"Incomplete OnFinality Credentials",
+			fmt.Sprintf("Env %s is set without %s, set both.", set, missing),
+		)
+		return "", "", 0
+	}
+
+	profile := defaultProfile
+	explicitProfile := false
+	if v := os.Getenv("ONFINALITY_PROFILE"); v != "" {
+		profile = v
+		explicitProfile = true
+	}
+	if !data.Profile.IsNull() && !data.Profile.IsUnknown() && data.Profile.Value != "" {
+		profile = data.Profile.Value
+		explicitProfile = true
+	}
+
+	file, err := credentialsFilePath()
+	if err == nil {
+		_, err = os.Stat(file)
+	}
+	if err != nil && !explicitProfile {
+		diags.AddError(
+			"Missing OnFinality Credentials",
+			"Set access_key and secret_key in the provider block, set env ONFINALITY_ACCESS_KEY and ONFINALITY_SECRET_KEY, or run `onf setup` to create a credentials file.",
+		)
+		return "", "", 0
+	}
+	if err != nil {
+		diags.AddAttributeError(path.Root("profile"), "Unable to Read Credentials File", fmt.Sprintf("Unable to read credentials for profile %q, got error: %s", profile, err))
+		return "", "", 0
+	}
+
+	creds, err := loadProfileCredentials(file, profile)
+	if err != nil {
+		diags.AddAttributeError(path.Root("profile"), "Unable to Read Credentials File", fmt.Sprintf("Unable to read credentials from %s, got error: %s", file, err))
+		return "", "", 0
+	}
+	accessKey, secretKey = creds.AccessKey, creds.SecretKey
+	if accessKey == "" || secretKey == "" {
+		diags.AddAttributeError(
+			path.Root("profile"),
+			"Missing OnFinality Credentials",
+			fmt.Sprintf("Profile %q in %s doesn't contain both onf_access_key and onf_secret_key.", profile, file),
+		)
+		return "", "", 0
+	}
+	return accessKey, secretKey, creds.WorkspaceId
+}
+
+// userAgent identifies the provider and Terraform versions to the API, e.g.
+// "terraform-provider-onfinality/0.1.0 terraform/1.3.2 my-pipeline".
+func userAgent(version string, terraformVersion string, suffix string) string {
+	ua := "terraform-provider-onfinality/" + version
+	if terraformVersion != "" {
+		ua += " terraform/" + terraformVersion
+	}
+	if suffix = strings.TrimSpace(suffix); suffix != "" {
+		ua += " " + suffix
+	}
+	return ua
+}
+
+// validateApiUrl checks that u is an absolute http or https URL with a host.
+func validateApiUrl(u string) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if parsed.Host == "" {
+		return fmt.Errorf("host is missing")
+	}
+	if parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("query and fragment are not allowed")
+	}
+	return nil
+}
+
 func (p *onfinalityProvider) GetResources(ctx context.Context) (map[string]provider.ResourceType, diag.Diagnostics) {
 	return map[string]provider.ResourceType{
 		"onfinality_node": onFinalityNode{},
@@ -66,20 +381,79 @@ func (p *onfinalityProvider) GetResources(ctx context.Context) (map[string]provi
 }
 
 func (p *onfinalityProvider) GetDataSources(ctx context.Context) (map[string]provider.DataSourceType, diag.Diagnostics) {
-	return map[string]provider.DataSourceType{}, nil
+	return map[string]provider.DataSourceType{
+		"onfinality_caller_identity": callerIdentityDataSourceType{},
+	}, nil
 }
 
 func (p *onfinalityProvider) GetSchema(ctx context.Context) (tfsdk.Schema, diag.Diagnostics) {
 	return tfsdk.Schema{
 		Attributes: map[string]tfsdk.Attribute{
 			"access_key": {
-				MarkdownDescription: "access key for https://app.onfinality.io, use env TF_VAR_onf_access_key to set up",
-				Required:            true,
+				MarkdownDescription: "access key for https://app.onfinality.io. Can also be set with env ONFINALITY_ACCESS_KEY, otherwise it is read from the onf CLI credentials file. Must be set together with `secret_key`, both keys come from the same source",
+				Optional:            true,
+				Sensitive:           true,
 				Type:                types.StringType,
 			},
 			"secret_key": {
-				MarkdownDescription: "secret key for https://app.onfinality.io, use env TF_VAR_onf_secret_key to set up",
-				Required:            true,
+				MarkdownDescription: "secret key for https://app.onfinality.io. Can also be set with env ONFINALITY_SECRET_KEY, otherwise it is read from the onf CLI credentials file. Must be set together with `access_key`, both keys come from the same source",
+				Optional:            true,
+				Sensitive:           true,
+				Type:                types.StringType,
+			},
+			"workspace_id": {
+				MarkdownDescription: "Default workspace id for resources which don't set their own, can get it from url https://app.onfinality.io/workspaces/<workspace_id>/nodes. Can also be set with env ONFINALITY_WORKSPACE_ID, otherwise the default_workspace of the profile the keys are read from is used",
+				Optional:            true,
+				Type:                types.Int64Type,
+			},
+			"max_retries": {
+				MarkdownDescription: fmt.Sprintf("Maximum number of times an API call is retried after a network error, a rate limit (429) or an unavailable gateway (502, 503, 504), defaults to %d. Creating a node, which could leave a duplicate node when sent twice, is only retried after a rate limit or a 503 with Retry-After. Retries back off exponentially and honour the Retry-After header", defaultMaxRetries),
+				Optional:            true,
+				Type:                types.Int64Type,
+			},
+			"ca_cert_file": {
+				MarkdownDescription: "Path to a PEM file of CA certificates to trust in addition to the system ones, e.g. for an egress proxy with a private CA",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"ca_cert_pem": {
+				MarkdownDescription: "PEM encoded CA certificates to trust in addition to the system ones",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"insecure_skip_verify": {
+				MarkdownDescription: "Don't verify the API's TLS certificate. Only use it for local testing",
+				Optional:            true,
+				Type:                types.BoolType,
+			},
+			"proxy_url": {
+				MarkdownDescription: "Proxy for API requests, e.g. `http://proxy.internal:3128`. Defaults to env HTTPS_PROXY / HTTP_PROXY / NO_PROXY",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"request_timeout": {
+				MarkdownDescription: "Maximum time a single API call may take, including its retries, e.g. `30s` or `2m`. Defaults to `" + defaultRequestTimeout.String() + "`",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"user_agent_suffix": {
+				MarkdownDescription: "Appended to the User-Agent of every API request, e.g. to tell pipelines apart in proxy logs. Can also be set with env ONFINALITY_USER_AGENT_SUFFIX",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"skip_credentials_validation": {
+				MarkdownDescription: "Skip checking the credentials against the API when the provider is configured",
+				Optional:            true,
+				Type:                types.BoolType,
+			},
+			"profile": {
+				MarkdownDescription: "Profile in the onf CLI credentials file (`~/.onf/credentials`, created by `onf setup`) used when the keys are not set, defaults to `default`. Can also be set with env ONFINALITY_PROFILE, the file location with env ONFINALITY_CREDENTIALS_FILE",
+				Optional:            true,
+				Type:                types.StringType,
+			},
+			"api_url": {
+				MarkdownDescription: "Base URL of the OnFinality API, defaults to `" + defaultApiUrl + "`. Can also be set with env ONFINALITY_API_URL",
+				Optional:            true,
 				Type:                types.StringType,
 			},
 		},
@@ -1,10 +1,24 @@
 package provider
 
 import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	onf "github.com/OnFinality-io/onf-cli/pkg/service"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
 )
 
 // testAccProtoV6ProviderFactories are used to instantiate a provider during
@@ -12,7 +26,7 @@ import (
 // CLI command executed to create a provider server to which the CLI can
 // reattach.
 var testAccProtoV6ProviderFactories = map[string]func() (tfprotov6.ProviderServer, error){
-	"scaffolding": providerserver.NewProtocol6WithError(New("test")()),
+	"onfinality": providerserver.NewProtocol6WithError(New("test")()),
 }
 
 func testAccPreCheck(t *testing.T) {
@@ -20,3 +34,246 @@ func testAccPreCheck(t *testing.T) {
 	// about the appropriate environment variables being set are common to see in a pre-check
 	// function.
 }
+
+func TestValidateApiUrl(t *testing.T) {
+	cases := map[string]bool{
+		"https://api.onfinality.io/api":  true,
+		"https://api.onfinality.io/api/": true,
+		"http://127.0.0.1:8080":          true,
+		"api.onfinality.io/api":          false,
+		"ftp://api.onfinality.io":        false,
+		"https://":                       false,
+		"https://api.onfinality.io/?a=b": false,
+		"://bad":                         false,
+	}
+	for u, valid := range cases {
+		err := validateApiUrl(u)
+		if valid && err != nil {
+			t.Errorf("expected %q to be valid, got error: %s", u, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("expected %q to be invalid", u)
+		}
+	}
+}
+
+// TestProviderAliasesAreIsolated configures two provider instances, as two
+// aliased provider blocks would be, and checks each one only ever talks to its
+// own endpoint with its own credentials.
+func TestProviderAliasesAreIsolated(t *testing.T) {
+	teamA := newFakeApi(t)
+	teamA.addNode(&nodeDetail{Node: onf.Node{ID: 1, WorkspaceID: 10, Name: "team a node", Storage: "100Gi", Image: "onfinality/polkadot:v0.9.27", Status: "running"}})
+	teamB := newFakeApi(t)
+	teamB.addNode(&nodeDetail{Node: onf.Node{ID: 2, WorkspaceID: 20, Name: "team b node", Storage: "100Gi", Image: "onfinality/kusama:v0.9.28", Status: "running"}})
+
+	a := configureTestProvider(t, teamA, "team-a-access")
+	b := configureTestProvider(t, teamB, "team-b-access")
+
+	// interleave the calls, a process-wide client would make the last
+	// configured provider win for both
+	if node := readTestNode(t, a, onFinalityNode{WorkspaceId: types.Int64{Value: 10}, Id: types.Int64{Value: 1}, Storage: Quantity{Null: true}}); node.NodeName.Value != "team a node" {
+		t.Errorf("expected team a node, got %q", node.NodeName.Value)
+	}
+	if node := readTestNode(t, b, onFinalityNode{WorkspaceId: types.Int64{Value: 20}, Id: types.Int64{Value: 2}, Storage: Quantity{Null: true}}); node.NodeName.Value != "team b node" {
+		t.Errorf("expected team b node, got %q", node.NodeName.Value)
+	}
+	if node := readTestNode(t, a, onFinalityNode{WorkspaceId: types.Int64{Value: 10}, Id: types.Int64{Value: 1}, Storage: Quantity{Null: true}}); node.NodeName.Value != "team a node" {
+		t.Errorf("expected team a node, got %q", node.NodeName.Value)
+	}
+
+	// each provider also lists workspaces once to validate its credentials
+	// and gets the clusters once, then each read gets the node
+	if teamA.requestsBy("team-a-access") != 4 || teamA.requestsBy("team-b-access") != 0 {
+		t.Errorf("team a server got unexpected requests: %v", teamA.accessKeys)
+	}
+	if teamB.requestsBy("team-b-access") != 3 || teamB.requestsBy("team-a-access") != 0 {
+		t.Errorf("team b server got unexpected requests: %v", teamB.accessKeys)
+	}
+}
+
+// configureTestProvider returns a provider configured against the fake API.
+func configureTestProvider(t *testing.T, fake *fakeApi, accessKey string) provider.Provider {
+	p, diags := configureProvider(t, testProviderData(fake, accessKey))
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	return p
+}
+
+// testProviderData is a provider block pointing at the fake API.
+func testProviderData(fake *fakeApi, accessKey string) providerData {
+	return providerData{
+		AccessKey:   types.String{Value: accessKey},
+		SecretKey:   types.String{Value: accessKey + "-secret"},
+		ApiUrl:      types.String{Value: fake.apiUrl()},
+		Profile:     types.String{Null: true},
+		WorkspaceId: types.Int64{Value: 10},
+		MaxRetries:  types.Int64{Value: 0},
+
+		UserAgentSuffix:           types.String{Null: true},
+		CaCertFile:                types.String{Null: true},
+		CaCertPem:                 types.String{Null: true},
+		InsecureSkipVerify:        types.Bool{Null: true},
+		ProxyUrl:                  types.String{Null: true},
+		RequestTimeout:            types.String{Null: true},
+		SkipCredentialsValidation: types.Bool{Null: true},
+	}
+}
+
+func configureProvider(t *testing.T, data providerData) (provider.Provider, diag.Diagnostics) {
+	ctx := context.Background()
+	p := New("test")()
+	schema, diags := p.GetSchema(ctx)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	config := tfsdk.Config{Schema: schema, Raw: testObject(t, schema, &data)}
+	resp := provider.ConfigureResponse{}
+	p.Configure(ctx, provider.ConfigureRequest{Config: config}, &resp)
+	return p, resp.Diagnostics
+}
+
+// readTestNode runs the onfinality_node Read with the given prior state and
+// returns the refreshed state.
+func readTestNode(t *testing.T, p provider.Provider, prior onFinalityNode) onFinalityNode {
+	ctx := context.Background()
+	r, diags := onFinalityNode{}.NewResource(ctx, p)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	schema, diags := onFinalityNode{}.GetSchema(ctx)
+	if diags.HasError() {
+		t.Fatal(diags)
+	}
+	state := tfsdk.State{Schema: schema, Raw: testObject(t, schema, &prior)}
+	resp := resource.ReadResponse{State: state}
+	r.Read(ctx, resource.ReadRequest{State: state}, &resp)
+	if resp.Diagnostics.HasError() {
+		t.Fatal(resp.Diagnostics)
+	}
+	var node onFinalityNode
+	if diags := resp.State.Get(ctx, &node); diags.HasError() {
+		t.Fatal(diags)
+	}
+	return node
+}
+
+// testObject converts a model struct to a value of the schema's object type.
+func testObject(t *testing.T, schema tfsdk.Schema, val interface{}) tftypes.Value {
+	ctx := context.Background()
+	state := tfsdk.State{Schema: schema, Raw: tftypes.NewValue(schema.TerraformType(ctx), nil)}
+	if diags := state.Set(ctx, val); diags.HasError() {
+		t.Fatal(diags)
+	}
+	return state.Raw
+}
+
+func TestProviderValidatesCredentials(t *testing.T) {
+	fake := newFakeApi(t)
+	cases := map[int]string{
+		http.StatusUnauthorized:        "Invalid OnFinality Credentials",
+		http.StatusForbidden:           "Forbidden OnFinality Credentials",
+		http.StatusInternalServerError: "Unable to Validate OnFinality Credentials",
+	}
+	for status, summary := range cases {
+		fake.setStatus(status)
+		_, diags := configureProvider(t, testProviderData(fake, "bad-access"))
+		if !diags.HasError() || diags.Errors()[0].Summary() != summary {
+			t.Errorf("expected %q for status %d, got %v", summary, status, diags)
+		}
+	}
+
+	data := testProviderData(fake, "bad-access")
+	data.SkipCredentialsValidation = types.Bool{Value: true}
+	if _, diags := configureProvider(t, data); diags.HasError() {
+		t.Errorf("expected validation to be skipped, got %v", diags)
+	}
+
+	// a response the client can't decode isn't a network error
+	garbled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer garbled.Close()
+	data = testProviderData(fake, "access")
+	data.ApiUrl = types.String{Value: garbled.URL + "/api"}
+	if _, diags := configureProvider(t, data); !diags.HasError() || diags.Errors()[0].Summary() != "Unable to Validate OnFinality Credentials" {
+		t.Errorf("expected an unexpected response error, got %v", diags)
+	}
+
+	fake.setStatus(0)
+	fake.Close()
+	_, diags := configureProvider(t, testProviderData(fake, "access"))
+	if !diags.HasError() || diags.Errors()[0].Summary() != "Unable to Reach OnFinality API" {
+		t.Errorf("expected an unreachable endpoint error, got %v", diags)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	cases := []struct {
+		version, terraformVersion, suffix, expected string
+	}{
+		{"0.1.0", "1.3.2", "", "terraform-provider-onfinality/0.1.0 terraform/1.3.2"},
+		{"0.1.0", "1.3.2", " ci-pipeline ", "terraform-provider-onfinality/0.1.0 terraform/1.3.2 ci-pipeline"},
+		{"dev", "", "", "terraform-provider-onfinality/dev"},
+	}
+	for _, c := range cases {
+		if ua := userAgent(c.version, c.terraformVersion, c.suffix); ua != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, ua)
+		}
+	}
+}
+
+func TestProviderTlsAndProxy(t *testing.T) {
+	fake := newFakeTlsApi(t)
+	caPem := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: fake.Certificate().Raw}))
+
+	data := testProviderData(fake, "access")
+	if _, diags := configureProvider(t, data); !diags.HasError() {
+		t.Error("expected the self-signed certificate to be rejected")
+	}
+
+	data.CaCertPem = types.String{Value: caPem}
+	if _, diags := configureProvider(t, data); diags.HasError() {
+		t.Errorf("expected the certificate to be trusted with ca_cert_pem, got %v", diags)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(caPem), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data.CaCertPem = types.String{Null: true}
+	data.CaCertFile = types.String{Value: caFile}
+	if _, diags := configureProvider(t, data); diags.HasError() {
+		t.Errorf("expected the certificate to be trusted with ca_cert_file, got %v", diags)
+	}
+
+	data.CaCertFile = types.String{Null: true}
+	data.InsecureSkipVerify = types.Bool{Value: true}
+	_, diags := configureProvider(t, data)
+	if diags.HasError() || diags.WarningsCount() != 1 {
+		t.Errorf("expected insecure_skip_verify to connect with a warning, got %v", diags)
+	}
+
+	data = testProviderData(newFakeApi(t), "access")
+	data.CaCertPem = types.String{Value: "not a certificate"}
+	if _, diags := configureProvider(t, data); !diags.HasError() {
+		t.Error("expected an invalid ca_cert_pem to be rejected")
+	}
+
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		fmt.Fprint(w, "[]")
+	}))
+	defer proxy.Close()
+	data = testProviderData(newFakeApi(t), "access")
+	data.WorkspaceId = types.Int64{Null: true}
+	data.ApiUrl = types.String{Value: "http://api.onfinality.invalid/api"}
+	data.ProxyUrl = types.String{Value: proxy.URL}
+	if _, diags := configureProvider(t, data); diags.HasError() {
+		t.Fatal(diags)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://api.onfinality.invalid/api/v1/workspaces" {
+		t.Errorf("expected the credentials check to go through the proxy, got %v", proxied)
+	}
+}
@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/attr/xattr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	k8sResource "k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	_ xattr.TypeWithValidate = QuantityType
+	_ attr.Value             = Quantity{}
+)
+
+// QuantityType is a string attribute holding a Kubernetes-style quantity such
+// as "100Gi" or "102400Mi". The format is validated at plan time.
+var QuantityType = quantityType{}
+
+type quantityType struct{}
+
+func (t quantityType) TerraformType(ctx context.Context) tftypes.Type {
+	return tftypes.String
+}
+
+func (t quantityType) ValueFromTerraform(ctx context.Context, in tftypes.Value) (attr.Value, error) {
+	if !in.IsKnown() {
+		return Quantity{Unknown: true}, nil
+	}
+	if in.IsNull() {
+		return Quantity{Null: true}, nil
+	}
+	var s string
+	if err := in.As(&s); err != nil {
+		return nil, err
+	}
+	return Quantity{Value: s}, nil
+}
+
+func (t quantityType) Equal(other attr.Type) bool {
+	_, ok := other.(quantityType)
+	return ok
+}
+
+func (t quantityType) String() string {
+	return "QuantityType"
+}
+
+func (t quantityType) ApplyTerraform5AttributePathStep(step tftypes.AttributePathStep) (interface{}, error) {
+	return nil, fmt.Errorf("cannot apply AttributePathStep %T to %s", step, t.String())
+}
+
+// Validate checks that known values parse as a quantity.
+func (t quantityType) Validate(ctx context.Context, in tftypes.Value, attrPath path.Path) diag.Diagnostics {
+	var diags diag.Diagnostics
+	if !in.IsKnown() || in.IsNull() {
+		return diags
+	}
+	var s string
+	if err := in.As(&s); err != nil {
+		diags.AddAttributeError(attrPath, "Invalid Quantity", fmt.Sprintf("Expected a string, got error: %s", err))
+		return diags
+	}
+	if _, err := k8sResource.ParseQuantity(s); err != nil {
+		diags.AddAttributeError(
+			attrPath,
+			"Invalid Quantity",
+			fmt.Sprintf("%q is not a quantity, use a number with a unit such as \"100Gi\" or \"102400Mi\".", s),
+		)
+	}
+	return diags
+}
+
+// Quantity is the value of a QuantityType attribute. Equal compares the text
+// as Terraform does, SemanticallyEqual compares the amount.
+type Quantity struct {
+	Unknown bool
+	Null    bool
+	Value   string
+}
+
+func (q Quantity) Type(ctx context.Context) attr.Type {
+	return QuantityType
+}
+
+func (q Quantity) ToTerraformValue(ctx context.Context) (tftypes.Value, error) {
+	if q.Null {
+		return tftypes.NewValue(tftypes.String, nil), nil
+	}
+	if q.Unknown {
+		return tftypes.NewValue(tftypes.String, tftypes.UnknownValue), nil
+	}
+	return tftypes.NewValue(tftypes.String, q.Value), nil
+}
+
+func (q Quantity) Equal(other attr.Value) bool {
+	o, ok := other.(Quantity)
+	if !ok {
+		return false
+	}
+	return q.Unknown == o.Unknown && q.Null == o.Null && q.Value == o.Value
+}
+
+func (q Quantity) IsNull() bool {
+	return q.Null
+}
+
+func (q Quantity) IsUnknown() bool {
+	return q.Unknown
+}
+
+func (q Quantity) String() string {
+	if q.Unknown {
+		return attr.UnknownValueString
+	}
+	if q.Null {
+		return attr.NullValueString
+	}
+	return fmt.Sprintf("%q", q.Value)
+}
+
+// Quantity parses the value.
+func (q Quantity) Quantity() (k8sResource.Quantity, error) {
+	return k8sResource.ParseQuantity(q.Value)
+}
+
+// SemanticallyEqual reports whether both values are known and the same
+// amount, e.g. "100Gi" and "102400Mi".
+func (q Quantity) SemanticallyEqual(other Quantity) bool {
+	if q.Unknown || q.Null || other.Unknown || other.Null {
+		return q.Equal(other)
+	}
+	a, err := q.Quantity()
+	if err != nil {
+		return q.Equal(other)
+	}
+	b, err := other.Quantity()
+	if err != nil {
+		return false
+	}
+	return a.Cmp(b) == 0
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+)
+
+func TestQuantityTypeValidate(t *testing.T) {
+	cases := map[string]bool{"100Gi": true, "102400Mi": true, "1.5Ti": true, "100 Gi": false, "lots": false, "": false}
+	for value, valid := range cases {
+		diags := QuantityType.Validate(context.Background(), tftypes.NewValue(tftypes.String, value), path.Root("storage"))
+		if diags.HasError() == valid {
+			t.Errorf("unexpected validation result for %q: %v", value, diags)
+		}
+	}
+	if diags := QuantityType.Validate(context.Background(), tftypes.NewValue(tftypes.String, tftypes.UnknownValue), path.Root("storage")); diags.HasError() {
+		t.Errorf("expected unknown values to be valid, got %v", diags)
+	}
+}
+
+func TestQuantitySemanticallyEqual(t *testing.T) {
+	cases := []struct {
+		a, b  Quantity
+		equal bool
+	}{
+		{Quantity{Value: "100Gi"}, Quantity{Value: "102400Mi"}, true},
+		{Quantity{Value: "100Gi"}, Quantity{Value: "100Gi"}, true},
+		{Quantity{Value: "100Gi"}, Quantity{Value: "100G"}, false},
+		{Quantity{Value: "100Gi"}, Quantity{Null: true}, false},
+		{Quantity{Unknown: true}, Quantity{Unknown: true}, true},
+		{Quantity{Value: "lots"}, Quantity{Value: "100Gi"}, false},
+	}
+	for _, c := range cases {
+		if c.a.SemanticallyEqual(c.b) != c.equal {
+			t.Errorf("expected %s and %s equal: %t", c.a, c.b, c.equal)
+		}
+	}
+}
+
+func TestNodeStorageKeepsConfiguredUnit(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeApi(t)
+	r := newTestNodeResource(t, configureTestProvider(t, fake, "access"))
+
+	created := createTestNode(t, r, testNodePlan())
+	var state onFinalityNode
+	created.State.Get(ctx, &state)
+
+	// the API reports the size in another unit
+	fake.updateNode(uint64(state.Id.Value), func(node *nodeDetail) { node.Storage = "102400Mi" })
+	var node onFinalityNode
+	readNodeResponse(t, r, state).State.Get(ctx, &node)
+	if node.Storage.Value != "100Gi" {
+		t.Errorf("expected the configured 100Gi to be kept, got %s", node.Storage)
+	}
+
+	fake.updateNode(uint64(state.Id.Value), func(node *nodeDetail) { node.Storage = "200Gi" })
+	readNodeResponse(t, r, state).State.Get(ctx, &node)
+	if node.Storage.Value != "200Gi" {
+		t.Errorf("expected a resized node to show up as drift, got %s", node.Storage)
+	}
+}
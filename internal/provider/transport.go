@@ -0,0 +1,297 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	// defaultMaxRetries is used when the provider block doesn't set max_retries.
+	defaultMaxRetries = 4
+	retryMinBackoff   = time.Second
+	retryMaxBackoff   = 30 * time.Second
+
+	// defaultRequestTimeout is used when the provider block doesn't set
+	// request_timeout.
+	defaultRequestTimeout = 5 * time.Minute
+)
+
+// transportOptions are the TLS and proxy settings of the provider block.
+type transportOptions struct {
+	// CaCerts are PEM blocks trusted in addition to the system CAs.
+	CaCerts            [][]byte
+	InsecureSkipVerify bool
+	// ProxyUrl overrides the proxy from the environment when set.
+	ProxyUrl *url.URL
+}
+
+// newBaseTransport returns the transport actually sending requests, a copy of
+// http.DefaultTransport with opts applied.
+func newBaseTransport(opts transportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.ProxyUrl != nil {
+		transport.Proxy = http.ProxyURL(opts.ProxyUrl)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if len(opts.CaCerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, pem := range opts.CaCerts {
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no PEM encoded certificate found")
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// retryTransport is a http.RoundTripper which retries requests failing with a
+// transport error, a rate limit (429) or an unavailable gateway (502, 503,
+// 504). Requests marked as not idempotent with withIdempotent, such as
+// creating a node, may have been processed when they fail that way, so
+// they're only retried when the API says it didn't process them: a rate limit,
+// or a 503 with Retry-After. It backs off exponentially with jitter between
+// attempts and honours the Retry-After header when the API sends one.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func newRetryTransport(next http.RoundTripper, maxRetries int) *retryTransport {
+	return &retryTransport{
+		next:       next,
+		maxRetries: maxRetries,
+		minBackoff: retryMinBackoff,
+		maxBackoff: retryMaxBackoff,
+	}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if attempt >= t.maxRetries || !shouldRetry(isIdempotent(req), resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			// drain the body so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		tflog.Warn(ctx, fmt.Sprintf("%s %s failed with %s, retrying in %s", req.Method, req.URL.Path, reason, wait), map[string]interface{}{
+			"attempt":     attempt + 1,
+			"max_retries": t.maxRetries,
+		})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+type idempotentKey struct{}
+
+// withIdempotent returns ctx recording whether requests sent with it can be
+// sent twice without side effects. Requests are idempotent by default.
+func withIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+func isIdempotent(req *http.Request) bool {
+	idempotent, ok := req.Context().Value(idempotentKey{}).(bool)
+	return !ok || idempotent
+}
+
+func shouldRetry(idempotent bool, resp *http.Response, err error) bool {
+	if err != nil {
+		return idempotent && !isPermanentError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		return idempotent || resp.Header.Get("Retry-After") != ""
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// isPermanentError reports whether err fails every attempt the same way, such
+// as a certificate which doesn't verify.
+func isPermanentError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var certificateInvalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &certificateInvalid) ||
+		errors.As(err, &hostname) || errors.As(err, &recordHeader)
+}
+
+// backoff returns how long to wait before the next attempt: the Retry-After
+// header if present, otherwise an exponential backoff with jitter between
+// half and the full backoff.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait
+		}
+	}
+	backoff := t.minBackoff << attempt
+	if backoff > t.maxBackoff || backoff <= 0 {
+		backoff = t.maxBackoff
+	}
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// a HTTP date.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// apiLogSubsystem is the tflog subsystem requests and responses are logged
+// to, its level can be set on its own with env TF_LOG_PROVIDER_ONFINALITY_API.
+const apiLogSubsystem = "api"
+
+var (
+	// sensitiveJsonField matches JSON string fields carrying keys, e.g. a
+	// node's API key in a node detail response.
+	sensitiveJsonField = regexp.MustCompile(`("(?i:api_?key|node_?key|access_?key|secret_?key)"\s*:\s*)"[^"]*"`)
+	// sensitiveQueryParam matches API keys passed in endpoint URLs, e.g.
+	// wss://polkadot.api.onfinality.io/ws?apikey=...
+	sensitiveQueryParam = regexp.MustCompile(`(?i)(api_?key=)[^&"\s]+`)
+)
+
+// loggingTransport is a http.RoundTripper logging every request and response
+// to the api subsystem: method, path, status and latency at DEBUG, bodies at
+// TRACE. Credentials and node API keys are masked, so the output can be
+// attached to support tickets.
+type loggingTransport struct {
+	next    http.RoundTripper
+	secrets []string
+}
+
+func newLoggingTransport(next http.RoundTripper, secrets ...string) *loggingTransport {
+	var nonEmpty []string
+	for _, secret := range secrets {
+		if secret != "" {
+			nonEmpty = append(nonEmpty, secret)
+		}
+	}
+	return &loggingTransport{next: next, secrets: nonEmpty}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := tflog.NewSubsystem(req.Context(), apiLogSubsystem, tflog.WithLevelFromEnv("TF_LOG_PROVIDER_ONFINALITY_API"))
+	ctx = tflog.SubsystemMaskLogStrings(ctx, apiLogSubsystem, t.secrets...)
+	fields := map[string]interface{}{
+		"http_method": req.Method,
+		"http_path":   req.URL.Path,
+	}
+
+	if req.GetBody != nil && req.ContentLength > 0 {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(body)
+			tflog.SubsystemTrace(ctx, apiLogSubsystem, "Sending API request body", map[string]interface{}{
+				"http_method":       req.Method,
+				"http_path":         req.URL.Path,
+				"http_request_body": t.redact(string(data)),
+			})
+		}
+	}
+	tflog.SubsystemDebug(ctx, apiLogSubsystem, "Sending API request", fields)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	fields["latency_ms"] = time.Since(start).Milliseconds()
+	if err != nil {
+		fields["error"] = t.redact(err.Error())
+		tflog.SubsystemDebug(ctx, apiLogSubsystem, "API request failed", fields)
+		return resp, err
+	}
+
+	fields["http_status"] = resp.StatusCode
+	tflog.SubsystemDebug(ctx, apiLogSubsystem, "Received API response", fields)
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return resp, err
+	}
+	tflog.SubsystemTrace(ctx, apiLogSubsystem, "Received API response body", map[string]interface{}{
+		"http_method":        req.Method,
+		"http_path":          req.URL.Path,
+		"http_status":        resp.StatusCode,
+		"http_response_body": t.redact(string(data)),
+	})
+	return resp, nil
+}
+
+// redact masks the provider's credentials and any node API keys in s.
+func (t *loggingTransport) redact(s string) string {
+	for _, secret := range t.secrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	s = sensitiveJsonField.ReplaceAllString(s, `$1"***"`)
+	return sensitiveQueryParam.ReplaceAllString(s, "${1}***")
+}
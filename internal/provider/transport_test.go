@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+)
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch {
+		case r.URL.Path == "/bad-request":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.URL.Path == "/always-unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/bad-gateway":
+			w.WriteHeader(http.StatusBadGateway)
+		case attempts == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case attempts == 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	transport := newRetryTransport(http.DefaultTransport, 3)
+	transport.minBackoff = time.Millisecond
+	transport.maxBackoff = 5 * time.Millisecond
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Post(server.URL+"/ok", "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || attempts != 3 {
+		t.Errorf("expected success on the third attempt, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+	for _, body := range bodies {
+		if body != `{"a":1}` {
+			t.Errorf("expected the body to be replayed on every attempt, got %q", body)
+		}
+	}
+
+	attempts = 0
+	resp, _ = client.Get(server.URL + "/always-unavailable")
+	if resp.StatusCode != http.StatusServiceUnavailable || attempts != 4 {
+		t.Errorf("expected to give up after 3 retries, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+
+	attempts = 0
+	resp, _ = client.Get(server.URL + "/bad-gateway")
+	if resp.StatusCode != http.StatusBadGateway || attempts != 4 {
+		t.Errorf("expected a GET to be retried, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+
+	attempts = 0
+	resp, _ = client.Get(server.URL + "/bad-request")
+	if resp.StatusCode != http.StatusBadRequest || attempts != 1 {
+		t.Errorf("expected no retry for a bad request, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+
+	attempts = 0
+	resp, _ = client.Post(server.URL+"/bad-gateway", "application/json", strings.NewReader(`{"a":1}`))
+	if resp.StatusCode != http.StatusBadGateway || attempts != 4 {
+		t.Errorf("expected an idempotent POST to be retried, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+
+	// a request which isn't idempotent may have been processed, e.g. created
+	// a node
+	for _, path := range []string{"/bad-gateway", "/always-unavailable"} {
+		attempts = 0
+		resp, _ = client.Do(newNonIdempotentRequest(t, server.URL+path))
+		if resp.StatusCode == http.StatusOK || attempts != 1 {
+			t.Errorf("expected no retry for a non-idempotent request to %s, got %d after %d attempts", path, resp.StatusCode, attempts)
+		}
+	}
+}
+
+func newNonIdempotentRequest(t *testing.T, url string) *http.Request {
+	req, err := http.NewRequestWithContext(withIdempotent(context.Background(), false), http.MethodPost, url, strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+type countingTransport struct {
+	next     http.RoundTripper
+	attempts int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.attempts++
+	return t.next.RoundTrip(req)
+}
+
+func TestRetryTransportErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the certificate isn't trusted, retrying won't change that
+	counting := &countingTransport{next: http.DefaultTransport}
+	transport := newRetryTransport(counting, 3)
+	transport.minBackoff = time.Millisecond
+	transport.maxBackoff = 5 * time.Millisecond
+	client := &http.Client{Transport: transport}
+	if _, err := client.Get(server.URL); err == nil || counting.attempts != 1 {
+		t.Errorf("expected no retry for an untrusted certificate, got %v after %d attempts", err, counting.attempts)
+	}
+
+	addr := server.Listener.Addr().String()
+	server.Close()
+	counting.attempts = 0
+	if _, err := client.Get("http://" + addr); err == nil || counting.attempts != 4 {
+		t.Errorf("expected a GET to be retried on connection errors, got %v after %d attempts", err, counting.attempts)
+	}
+	counting.attempts = 0
+	if _, err := client.Do(newNonIdempotentRequest(t, "http://"+addr)); err == nil || counting.attempts != 1 {
+		t.Errorf("expected no retry for a non-idempotent request on connection errors, got %v after %d attempts", err, counting.attempts)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("7"); !ok || wait != 7*time.Second {
+		t.Errorf("unexpected wait %s", wait)
+	}
+	at := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if wait, ok := parseRetryAfter(at); !ok || wait <= 0 || wait > time.Minute {
+		t.Errorf("unexpected wait %s", wait)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("expected an invalid Retry-After to be ignored")
+	}
+}
+
+func TestLoggingTransportRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "1", "apiKey": "node-api-key", "endpoints": {"ws": "wss://polkadot.api.onfinality.io/ws?apikey=node-api-key"}}`)
+	}))
+	defer server.Close()
+
+	var output bytes.Buffer
+	ctx := tflogtest.RootLogger(context.Background(), &output)
+	t.Setenv("TF_LOG_PROVIDER_ONFINALITY_API", "TRACE")
+	client := &http.Client{Transport: newLoggingTransport(http.DefaultTransport, "my-access-key", "my-secret-key")}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/api/v1/workspaces/1/nodes", strings.NewReader(`{"accessKey":"my-access-key","note":"my-secret-key"}`))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "node-api-key") {
+		t.Errorf("expected the response body to be passed through unchanged, got %s", body)
+	}
+
+	entries, err := tflogtest.MultilineJSONDecode(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("expected 4 log entries, got %d: %s", len(entries), output.String())
+	}
+	logged := fmt.Sprint(entries)
+	for _, secret := range []string{"my-access-key", "my-secret-key", "node-api-key"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("expected %q to be masked in %s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, "/api/v1/workspaces/1/nodes") || !strings.Contains(logged, "latency_ms") {
+		t.Errorf("expected the path and latency to be logged, got %s", logged)
+	}
+}
@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+func DurationValidator() tfsdk.AttributeValidator {
+	return durationValidator{}
+}
+
+// durationValidator is an AttributeValidator checking that a string attribute
+// is a positive Go duration, e.g. "30s", "10m" or "1h30m".
+type durationValidator struct{}
+
+func (v durationValidator) Validate(ctx context.Context, req tfsdk.ValidateAttributeRequest, resp *tfsdk.ValidateAttributeResponse) {
+	value, ok := req.AttributeConfig.(types.String)
+	if !ok || value.IsNull() || value.IsUnknown() {
+		return
+	}
+	d, err := time.ParseDuration(value.Value)
+	if err != nil || d <= 0 {
+		resp.Diagnostics.AddAttributeError(
+			req.AttributePath,
+			"Invalid Duration",
+			fmt.Sprintf("%q is not a positive duration, use a number with a unit such as \"30s\", \"10m\" or \"1h30m\".", value.Value),
+		)
+	}
+}
+
+// Description returns a human-readable description of the validator.
+func (v durationValidator) Description(ctx context.Context) string {
+	return "Value must be a positive duration such as 30s, 10m or 1h30m."
+}
+
+// MarkdownDescription returns a markdown description of the validator.
+func (v durationValidator) MarkdownDescription(ctx context.Context) string {
+	return "Value must be a positive duration such as `30s`, `10m` or `1h30m`."
+}
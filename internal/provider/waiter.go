@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+// defaultPollInterval is how often waiters check the node status.
+const defaultPollInterval = 3 * time.Second
+
+// statusWaiter polls a status until it reaches one of Target. Unlike the onf
+// CLI watcher it stops as soon as the context is cancelled, e.g. by Ctrl-C or
+// a Terraform Cloud cancel.
+type statusWaiter struct {
+	// Pending are the statuses expected on the way to Target, any other
+	// status fails the wait. An empty Pending accepts any status.
+	Pending []string
+	// Target are the statuses the wait succeeds on.
+	Target []string
+	// Failed are the statuses the wait fails on straight away.
+	Failed       []string
+	PollInterval time.Duration
+	Timeout      time.Duration
+	// Refresh returns the current status.
+	Refresh func(ctx context.Context) (string, error)
+}
+
+// timeoutError is returned when the status doesn't reach Target in time.
+type timeoutError struct {
+	LastStatus string
+	Target     []string
+	Timeout    time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("status didn't become %v within %s, last observed status: %s", e.Target, e.Timeout, e.LastStatus)
+}
+
+// unexpectedStatusError is returned when the status is failed, or neither
+// pending nor target.
+type unexpectedStatusError struct {
+	Status string
+	Target []string
+}
+
+func (e *unexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s while waiting for %v", e.Status, e.Target)
+}
+
+// Wait blocks until the status is one of Target and returns it. It returns
+// the last observed status together with a *timeoutError, an
+// *unexpectedStatusError, the context's error or the Refresh error otherwise.
+func (w statusWaiter) Wait(ctx context.Context) (string, error) {
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	lastStatus := ""
+	for {
+		status, err := w.Refresh(waitCtx)
+		if err != nil {
+			if waitCtx.Err() != nil && ctx.Err() == nil {
+				return lastStatus, &timeoutError{LastStatus: lastStatus, Target: w.Target, Timeout: w.Timeout}
+			}
+			return lastStatus, err
+		}
+		if status != lastStatus {
+			tflog.Debug(ctx, fmt.Sprintf("Waiting for status %v, current status: %s", w.Target, status), map[string]interface{}{
+				"elapsed": time.Since(start).Round(time.Second).String(),
+			})
+		}
+		lastStatus = status
+
+		if containsStatus(w.Target, status) {
+			return status, nil
+		}
+		if containsStatus(w.Failed, status) || len(w.Pending) > 0 && !containsStatus(w.Pending, status) {
+			return status, &unexpectedStatusError{Status: status, Target: w.Target}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-waitCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return lastStatus, ctx.Err()
+			}
+			return lastStatus, &timeoutError{LastStatus: lastStatus, Target: w.Target, Timeout: w.Timeout}
+		case <-timer.C:
+		}
+	}
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// statusSequence returns a Refresh function walking through statuses, the
+// last one repeating forever.
+func statusSequence(statuses ...string) func(ctx context.Context) (string, error) {
+	i := 0
+	return func(ctx context.Context) (string, error) {
+		status := statuses[i]
+		if i < len(statuses)-1 {
+			i++
+		}
+		return status, nil
+	}
+}
+
+func TestStatusWaiter(t *testing.T) {
+	ctx := context.Background()
+
+	status, err := statusWaiter{
+		Pending:      []string{"pending", "initializing"},
+		Target:       []string{"running"},
+		PollInterval: time.Millisecond,
+		Timeout:      time.Second,
+		Refresh:      statusSequence("pending", "initializing", "running"),
+	}.Wait(ctx)
+	if err != nil || status != "running" {
+		t.Errorf("expected running, got %q %v", status, err)
+	}
+
+	status, err = statusWaiter{
+		Target:       []string{"running"},
+		PollInterval: time.Millisecond,
+		Timeout:      20 * time.Millisecond,
+		Refresh:      statusSequence("pending", "syncing"),
+	}.Wait(ctx)
+	var timeoutErr *timeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.LastStatus != "syncing" || status != "syncing" {
+		t.Errorf("expected a timeout with last status syncing, got %q %v", status, err)
+	}
+
+	status, err = statusWaiter{
+		Pending:      []string{"pending"},
+		Target:       []string{"running"},
+		PollInterval: time.Millisecond,
+		Timeout:      time.Second,
+		Refresh:      statusSequence("pending", "error"),
+	}.Wait(ctx)
+	var unexpectedErr *unexpectedStatusError
+	if !errors.As(err, &unexpectedErr) || status != "error" {
+		t.Errorf("expected an unexpected status error, got %q %v", status, err)
+	}
+
+	status, err = statusWaiter{
+		Target:       []string{"running"},
+		Failed:       []string{"error"},
+		PollInterval: time.Millisecond,
+		Timeout:      time.Second,
+		Refresh:      statusSequence("updating", "error", "running"),
+	}.Wait(ctx)
+	if !errors.As(err, &unexpectedErr) || status != "error" {
+		t.Errorf("expected the failed status to end the wait, got %q %v", status, err)
+	}
+
+	refreshErr := errors.New("boom")
+	_, err = statusWaiter{
+		Target:  []string{"running"},
+		Timeout: time.Second,
+		Refresh: func(ctx context.Context) (string, error) { return "", refreshErr },
+	}.Wait(ctx)
+	if err != refreshErr {
+		t.Errorf("expected the refresh error, got %v", err)
+	}
+}
+
+func TestStatusWaiterHonoursCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := statusWaiter{
+		Target:       []string{"running"},
+		PollInterval: time.Hour,
+		Timeout:      time.Hour,
+		Refresh:      statusSequence("pending"),
+	}.Wait(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the wait to stop on cancel, took %s", time.Since(start))
+	}
+}